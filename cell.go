@@ -0,0 +1,38 @@
+package vt
+
+import "unicode/utf8"
+
+// Cell 屏幕上的一个字符单元
+type Cell struct {
+	Text  string     // 单元中的字符，可能由多个码点组成（字素簇），占位单元为空
+	Width int        // 字符占用的列数，宽字符为2，宽字符其余列的占位单元为0
+	Attr  Attr       // 显示属性
+	Link  *Hyperlink // OSC 8 设置的超链接，没有时为 nil
+
+	protected bool // 由 DECSCA 设置，选择性擦除（DECSED、DECSEL）时保留
+}
+
+// 空白单元，使用指定的显示属性
+func blankCell(attr Attr) Cell {
+	return Cell{Text: string(space), Width: 1, Attr: attr}
+}
+
+// Rune 返回单元中的第一个码点
+func (c Cell) Rune() rune {
+	r, _ := utf8.DecodeRuneInString(c.Text)
+	return r
+}
+
+// IsBlank 返回单元是否为空白
+func (c Cell) IsBlank() bool {
+	return c.Text == string(space)
+}
+
+// IsPlaceholder 返回单元是否为宽字符其余列的占位单元
+func (c Cell) IsPlaceholder() bool {
+	return c.Width == 0
+}
+
+func (c Cell) String() string {
+	return c.Text
+}
@@ -0,0 +1,91 @@
+package vt
+
+const (
+	_SO rune = 0x0e // Shift Out，G1 字符集映射到 GL (Caret = ^N)
+	_SI rune = 0x0f // Shift In，G0 字符集映射到 GL (Caret = ^O)
+
+	charsetASCII      rune = 'B' // US ASCII
+	charsetUK         rune = 'A' // 英国字符集，# 显示为 £
+	charsetDECSpecial rune = '0' // DEC 特殊图形字符，用于绘制边框
+	noSingleShift          = -1
+)
+
+// DEC 特殊图形字符集中 0x5f-0x7e 对应的 Unicode 字符
+var decSpecialGraphics = map[rune]rune{
+	'_': 0x00a0, // 空白
+	'`': 0x25c6, // ◆
+	'a': 0x2592, // ▒
+	'b': 0x2409, // ␉
+	'c': 0x240c, // ␌
+	'd': 0x240d, // ␍
+	'e': 0x240a, // ␊
+	'f': 0x00b0, // °
+	'g': 0x00b1, // ±
+	'h': 0x2424, // ␤
+	'i': 0x240b, // ␋
+	'j': 0x2518, // ┘
+	'k': 0x2510, // ┐
+	'l': 0x250c, // ┌
+	'm': 0x2514, // └
+	'n': 0x253c, // ┼
+	'o': 0x23ba, // ⎺
+	'p': 0x23bb, // ⎻
+	'q': 0x2500, // ─
+	'r': 0x23bc, // ⎼
+	's': 0x23bd, // ⎽
+	't': 0x251c, // ├
+	'u': 0x2524, // ┤
+	'v': 0x2534, // ┴
+	'w': 0x252c, // ┬
+	'x': 0x2502, // │
+	'y': 0x2264, // ≤
+	'z': 0x2265, // ≥
+	'{': 0x03c0, // π
+	'|': 0x2260, // ≠
+	'}': 0x00a3, // £
+	'~': 0x00b7, // ·
+}
+
+func (vt *virtualTerminal) resetCharsets() {
+	vt.charsets = [4]rune{charsetASCII, charsetASCII, charsetASCII, charsetASCII}
+	vt.gl = 0
+	vt.singleShift = noSingleShift
+}
+
+// 指定 G0-G3 字符集，charset 为字符集的最终字符，例如 B 为 ASCII，0 为 DEC 特殊图形字符
+func (vt *virtualTerminal) designateCharset(g int, charset rune) {
+	vt.charsets[g] = charset
+}
+
+// 将 G0-G3 中的一个字符集映射到 GL（LS0、LS1、LS2、LS3）
+func (vt *virtualTerminal) invokeCharset(g int) {
+	vt.gl = g
+}
+
+// 下一个字符使用 G2 或 G3 字符集（SS2、SS3）
+func (vt *virtualTerminal) setSingleShift(g int) {
+	vt.singleShift = g
+}
+
+// 按照当前字符集转换字符，只有 ASCII 范围内的字符会被转换
+func (vt *virtualTerminal) translateCharset(code rune) rune {
+	g := vt.gl
+	if vt.singleShift != noSingleShift {
+		g = vt.singleShift
+		vt.singleShift = noSingleShift
+	}
+	if code < 0x20 || code > 0x7e {
+		return code
+	}
+	switch vt.charsets[g] {
+	case charsetDECSpecial:
+		if r, ok := decSpecialGraphics[code]; ok {
+			return r
+		}
+	case charsetUK:
+		if code == '#' {
+			return 0x00a3
+		}
+	}
+	return code
+}
@@ -0,0 +1,216 @@
+package vt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const exitCodeUnknown = -1 // 没有上报退出码
+
+// CommandBlock 由 shell integration（OSC 133）划分出的一条命令
+type CommandBlock struct {
+	Prompt   string   // 提示符
+	Command  string   // 命令行，多行命令以换行符分隔
+	Output   []string // 命令的输出，自动换行的行会被合并
+	ExitCode int      // 命令的退出码，没有上报时为 -1
+	Finished bool     // 命令是否已经结束
+	Dir      string   // 执行命令时 shell 上报的当前目录
+	Host     string   // 执行命令时 shell 上报的主机名
+}
+
+// 屏幕上的一个位置，line 为从终端输出的第一行开始计数的行号
+type position struct {
+	line, col int
+}
+
+type commandStage uint8
+
+const (
+	stagePrompt   commandStage = iota // 收到 A，正在显示提示符
+	stageCommand                      // 收到 B，正在输入命令
+	stageOutput                       // 收到 C，命令正在执行
+	stageFinished                     // 收到 D，命令已经结束
+)
+
+// 一条命令各部分的起始位置，文本在获取时才从屏幕和 scrollback 中读取
+type commandMarks struct {
+	stage    commandStage
+	prompt   position
+	command  position
+	output   position
+	end      position
+	exitCode int
+	dir      string
+	host     string
+}
+
+/**
+ * OSC 133 ; Ps ST  FinalTerm shell integration，iTerm2、VS Code、WezTerm 等终端都支持
+ *
+ * | Ps                | Action                             |
+ * | ----------------- | ---------------------------------- |
+ * | A                 | 提示符开始                         |
+ * | B                 | 提示符结束，开始输入命令           |
+ * | C                 | 命令开始执行，之后为命令的输出     |
+ * | D ; exit code     | 命令结束，退出码可以省略           |
+ *
+ * 每一项之后可以带有 ; 分隔的 key=value 选项，例如 A;aid=123，这些选项被忽略
+ */
+func (vt *virtualTerminal) handleShellIntegration(pt string) {
+	vt.shellIntegration = true
+	fields := strings.Split(pt, string(_SEMICOLON))
+	switch fields[0] {
+	case "A":
+		vt.promptStart()
+	case "B":
+		vt.commandStart()
+	case "C":
+		vt.outputStart()
+	case "D":
+		exitCode := exitCodeUnknown
+		if len(fields) > 1 {
+			if n, err := strconv.Atoi(fields[1]); err == nil {
+				exitCode = n
+			}
+		}
+		vt.commandFinished(exitCode)
+	default:
+		vt.log(fmt.Sprintf("unsupported shell integration sequence %q", pt))
+	}
+}
+
+// 光标所在的位置，等待换行时光标所在的字符已经写入
+func (vt *virtualTerminal) currentPosition() position {
+	if vt.wrapPending {
+		return position{line: vt.lineNumber(), col: vt.x + 1}
+	}
+	return position{line: vt.lineNumber(), col: vt.x}
+}
+
+// 当前正在进行的命令，没有时以光标所在位置作为提示符的开始
+func (vt *virtualTerminal) currentCommand() *commandMarks {
+	if n := len(vt.commands); n > 0 && vt.commands[n-1].stage != stageFinished {
+		return vt.commands[n-1]
+	}
+	vt.promptStart()
+	return vt.commands[len(vt.commands)-1]
+}
+
+// 新的提示符开始时，没有收到 D 的命令视为已经结束
+func (vt *virtualTerminal) promptStart() {
+	vt.commandFinished(exitCodeUnknown)
+	pos := vt.currentPosition()
+	vt.commands = append(vt.commands, &commandMarks{
+		prompt:   pos,
+		command:  pos,
+		output:   pos,
+		end:      pos,
+		exitCode: exitCodeUnknown,
+		dir:      vt.session.CurrentDir,
+		host:     vt.session.Host,
+	})
+}
+
+func (vt *virtualTerminal) commandStart() {
+	c := vt.currentCommand()
+	if c.stage >= stageCommand {
+		return
+	}
+	c.stage = stageCommand
+	c.command = vt.currentPosition()
+}
+
+func (vt *virtualTerminal) outputStart() {
+	c := vt.currentCommand()
+	if c.stage >= stageOutput {
+		return
+	}
+	if c.stage < stageCommand {
+		// 没有收到 B 时提示符和命令无法区分，都作为命令
+		c.command = c.prompt
+	}
+	c.stage = stageOutput
+	c.output = vt.currentPosition()
+	c.dir = vt.session.CurrentDir
+	c.host = vt.session.Host
+}
+
+func (vt *virtualTerminal) commandFinished(exitCode int) {
+	n := len(vt.commands)
+	if n == 0 || vt.commands[n-1].stage == stageFinished {
+		return
+	}
+	c := vt.commands[n-1]
+	// 没有执行命令，例如在提示符处按下 Ctrl+C
+	if c.stage < stageCommand {
+		c.command = vt.currentPosition()
+	}
+	if c.stage < stageOutput {
+		c.output = vt.currentPosition()
+	}
+	c.stage = stageFinished
+	c.end = vt.currentPosition()
+	c.exitCode = exitCode
+}
+
+// [from, to) 范围内的文本，自动换行的行会被合并，去除每行末尾和最后的空行
+func (vt *virtualTerminal) textBetween(from, to position) []string {
+	var lines []string
+	var b strings.Builder
+	for n := from.line; n <= to.line; n++ {
+		row := vt.line(n)
+		if row == nil {
+			b.Reset()
+			lines = append(lines, "")
+			continue
+		}
+		start, end := 0, vt.cols
+		if n == from.line {
+			start = from.col
+		}
+		if n == to.line {
+			end = to.col
+		}
+		if row.wrapped && n < to.line {
+			b.WriteString(row.slice(start, min(end, row.wrapEnd())))
+			continue
+		}
+		text := row.slice(start, end)
+		b.WriteString(strings.TrimRight(text, string(space)))
+		lines = append(lines, b.String())
+		b.Reset()
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return lines
+}
+
+func (vt *virtualTerminal) commandBlock(c *commandMarks) CommandBlock {
+	end := c.end
+	if c.stage != stageFinished {
+		end = vt.currentPosition()
+	}
+	block := CommandBlock{
+		ExitCode: c.exitCode,
+		Finished: c.stage == stageFinished,
+		Dir:      c.dir,
+		Host:     c.host,
+	}
+	if c.stage < stageCommand {
+		block.Prompt = strings.Join(vt.textBetween(c.prompt, end), "\n")
+		return block
+	}
+	block.Prompt = strings.Join(vt.textBetween(c.prompt, c.command), "\n")
+	if c.stage < stageOutput {
+		block.Command = strings.Join(vt.textBetween(c.command, end), "\n")
+		return block
+	}
+	block.Command = strings.Join(vt.textBetween(c.command, c.output), "\n")
+	block.Output = vt.textBetween(c.output, end)
+	return block
+}
@@ -1,97 +1,116 @@
 package vt
 
 func (vt *virtualTerminal) initCsiHandler() {
-	vt.addCsiHandler('@', vt.insertChar)
-	vt.addCsiHandler('A', vt.cursorUp)
-	vt.addCsiHandler('B', vt.cursorDown)
-	vt.addCsiHandler('C', vt.cursorForward)
-	vt.addCsiHandler('D', vt.cursorBackward)
-	vt.addCsiHandler('E', vt.cursorNextLine)
-	vt.addCsiHandler('F', vt.cursorPrecedingLine)
-	vt.addCsiHandler('G', vt.cursorCharAbsolute)
-	vt.addCsiHandler('H', vt.cursorPosition)
-	vt.addCsiHandler('J', vt.eraseInDisplay)
-	vt.addCsiHandler('K', vt.eraseInLine)
-	vt.addCsiHandler('P', vt.deleteChars)
-	vt.addCsiHandler('X', vt.eraseChars)
-	vt.addCsiHandler('`', vt.charPosAbsolute)
-	vt.addCsiHandler('a', vt.hPositionRelative)
-	vt.addCsiHandler('d', vt.linePosAbsolute)
-	vt.addCsiHandler('e', vt.vPositionRelative)
-	vt.addCsiHandler('f', vt.hVPosition)
-	vt.addCsiHandler('h', vt.setMode)
-	vt.addCsiHandler('l', vt.resetMode)
-	vt.addCsiHandler('m', vt.charAttributes)
-	vt.addCsiHandler('r', vt.setScrollRegion)
-}
-
-func (vt *virtualTerminal) cursorChange(params []rune, action func(ps int)) {
-	ps := vt.getNumberOrDefault(params, 0, 1)
-	action(ps)
+	vt.addCsiHandler("@", vt.insertChar)
+	vt.addCsiHandler("A", vt.cursorUp)
+	vt.addCsiHandler("B", vt.cursorDown)
+	vt.addCsiHandler("C", vt.cursorForward)
+	vt.addCsiHandler("D", vt.cursorBackward)
+	vt.addCsiHandler("E", vt.cursorNextLine)
+	vt.addCsiHandler("F", vt.cursorPrecedingLine)
+	vt.addCsiHandler("G", vt.cursorCharAbsolute)
+	vt.addCsiHandler("H", vt.cursorPosition)
+	vt.addCsiHandler("I", vt.cursorForwardTab)
+	vt.addCsiHandler("J", vt.eraseInDisplay)
+	vt.addCsiHandler("K", vt.eraseInLine)
+	vt.addCsiHandler("?J", vt.selectiveEraseInDisplay)
+	vt.addCsiHandler("?K", vt.selectiveEraseInLine)
+	vt.addCsiHandler("L", vt.insertLine)
+	vt.addCsiHandler("M", vt.deleteLine)
+	vt.addCsiHandler("P", vt.deleteChars)
+	vt.addCsiHandler("S", vt.scrollLinesUp)
+	vt.addCsiHandler("T", vt.scrollLinesDown)
+	vt.addCsiHandler("X", vt.eraseChars)
+	vt.addCsiHandler("Z", vt.cursorBackwardTab)
+	vt.addCsiHandler("`", vt.charPosAbsolute)
+	vt.addCsiHandler("c", vt.sendPrimaryDeviceAttributes)
+	vt.addCsiHandler(">c", vt.sendSecondaryDeviceAttributes)
+	vt.addCsiHandler("a", vt.hPositionRelative)
+	vt.addCsiHandler("d", vt.linePosAbsolute)
+	vt.addCsiHandler("e", vt.vPositionRelative)
+	vt.addCsiHandler("f", vt.hVPosition)
+	vt.addCsiHandler("g", vt.tabClear)
+	vt.addCsiHandler("h", vt.setMode)
+	vt.addCsiHandler("l", vt.resetMode)
+	vt.addCsiHandler("?h", vt.setPrivateMode)
+	vt.addCsiHandler("?l", vt.resetPrivateMode)
+	vt.addCsiHandler("$p", vt.requestMode)
+	vt.addCsiHandler("?$p", vt.requestPrivateMode)
+	vt.addCsiHandler("m", vt.charAttributes)
+	vt.addCsiHandler("n", vt.deviceStatusReport)
+	vt.addCsiHandler("?n", vt.privateDeviceStatusReport)
+	vt.addCsiHandler(">q", vt.reportVersion)
+	vt.addCsiHandler("\"q", vt.charProtectionAttribute)
+	vt.addCsiHandler("r", vt.setScrollRegion)
+	vt.addCsiHandler("s", vt.saveCursorPosition)
+	vt.addCsiHandler("t", vt.windowManipulation)
+	vt.addCsiHandler("u", vt.restoreCursorPosition)
+}
+
+func (vt *virtualTerminal) cursorChange(seq *csiSequence, action func(ps int)) {
+	ps := seq.getNumberOrDefault(0, 1)
+	// 参数为0时视为1
+	action(max(ps, 1))
 }
 
 // insert Ps (Blank) Character(s) (default = 1) (ICH).
-func (vt *virtualTerminal) insertChar(params []rune) error {
-	row := vt.getCurrentRow()
-	ps := vt.getNumberOrDefault(params, 0, 1)
-	for i := 0; i < ps; i++ {
-		row.insert(space)
-	}
+func (vt *virtualTerminal) insertChar(seq *csiSequence) error {
+	vt.cursorChange(seq, func(ps int) {
+		vt.getCurrentRow().insert(vt.x, ps, vt.eraseAttr())
+	})
 	return nil
 }
 
 // 光标向指定的方向移动{n（默认1）格。如果光标已在屏幕边缘，则无效。
-func (vt *virtualTerminal) cursorUp(params []rune) error {
-	vt.cursorChange(params, vt.moveUp)
+func (vt *virtualTerminal) cursorUp(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.moveUp)
 	return nil
 }
 
 // 光标向指定的方向移动{n（默认1）格。如果光标已在屏幕边缘，则无效。
-func (vt *virtualTerminal) cursorDown(params []rune) error {
-	vt.cursorChange(params, vt.moveDown)
+func (vt *virtualTerminal) cursorDown(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.moveDown)
 	return nil
 }
 
 // 光标向指定的方向移动{n（默认1）格。如果光标已在屏幕边缘，则无效。
-func (vt *virtualTerminal) cursorForward(params []rune) error {
-	vt.cursorChange(params, vt.moveForward)
+func (vt *virtualTerminal) cursorForward(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.moveForward)
 	return nil
 }
 
 // 光标向指定的方向移动{n（默认1）格。如果光标已在屏幕边缘，则无效。
-func (vt *virtualTerminal) cursorBackward(params []rune) error {
-	vt.cursorChange(params, vt.moveBackward)
+func (vt *virtualTerminal) cursorBackward(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.moveBackward)
 	return nil
 }
 
 // 光标移动到下面第n（默认1）行的开头。
-func (vt *virtualTerminal) cursorNextLine(params []rune) error {
-	return vt.cursorDown(params)
+func (vt *virtualTerminal) cursorNextLine(seq *csiSequence) error {
+	vt.setCol(0)
+	return vt.cursorDown(seq)
 }
 
 // 光标移动到上面第n（默认1）行的开头。
-func (vt *virtualTerminal) cursorPrecedingLine(params []rune) error {
-	return vt.cursorUp(params)
+func (vt *virtualTerminal) cursorPrecedingLine(seq *csiSequence) error {
+	vt.setCol(0)
+	return vt.cursorUp(seq)
 }
 
 // 光标移动到第n（默认1）列。
-func (vt *virtualTerminal) cursorCharAbsolute(params []rune) error {
-	vt.cursorChange(params, func(ps int) {
-		vt.moveTo(ps, vt.rows)
+func (vt *virtualTerminal) cursorCharAbsolute(seq *csiSequence) error {
+	vt.cursorChange(seq, func(ps int) {
+		vt.setCol(ps - 1)
 	})
 	return nil
 }
 
 // 光标移动到第n行、第m列。值从1开始，且默认为1（左上角）。
 // 例如CSI ;5H和CSI 1;5H含义相同；CSI 17;H、CSI 17H和CSI 17;1H三者含义相同。
-func (vt *virtualTerminal) cursorPosition(params []rune) error {
-	if len(params) >= 2 {
-		row := vt.getNumberOrDefault(params, 0, 1)
-		col := vt.getNumberOrDefault(params, 1, 1)
-		vt.moveTo(col, row)
-	} else {
-		vt.resetCursor()
-	}
+func (vt *virtualTerminal) cursorPosition(seq *csiSequence) error {
+	row := seq.getNumberOrDefault(0, 1)
+	col := seq.getNumberOrDefault(1, 1)
+	vt.moveToOrigin(col-1, row-1)
 	return nil
 }
 
@@ -99,17 +118,17 @@ func (vt *virtualTerminal) cursorPosition(params []rune) error {
 // 如果n是1，则清除从光标位置到屏幕开头的部分。
 // 如果n是2，则清除整个屏幕（在DOS ANSI.SYS中，光标还会向左上方移动）。
 // 如果n是3，则清除整个屏幕，并删除回滚缓存区中的所有行（这个特性是xterm添加的，其他终端应用程序也支持）。
-func (vt *virtualTerminal) eraseInDisplay(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 0)
+func (vt *virtualTerminal) eraseInDisplay(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 0)
 	switch ps {
 	case 0:
 		return vt.eraseBelow()
 	case 1:
 		return vt.eraseAbove()
 	case 2:
-		return vt.eraseAll()
+		return vt.eraseDisplay()
 	case 3:
-		// 忽略 Erase Saved Lines (xterm)
+		return vt.eraseSavedLines()
 	}
 	return nil
 }
@@ -118,63 +137,94 @@ func (vt *virtualTerminal) eraseInDisplay(params []rune) error {
 // 如果n是0（或缺失），清除从光标位置到该行末尾的部分。
 // 如果n是1，清除从光标位置到该行开头的部分。
 // 如果n是2，清除整行。光标位置不变。
-func (vt *virtualTerminal) eraseInLine(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 0)
+func (vt *virtualTerminal) eraseInLine(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 0)
 	switch ps {
 	case 0:
 		return vt.eraseRight()
 	case 1:
 		return vt.eraseLeft()
 	case 2:
-		return vt.eraseAll()
+		return vt.eraseLine()
+	}
+	return nil
+}
+
+// Insert Ps Line(s) (default = 1) (IL).
+func (vt *virtualTerminal) insertLine(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.insertLines)
+	return nil
+}
+
+// Delete Ps Line(s) (default = 1) (DL).
+func (vt *virtualTerminal) deleteLine(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.deleteLines)
+	return nil
+}
+
+// Scroll up Ps lines (default = 1) (SU)，光标位置不变
+func (vt *virtualTerminal) scrollLinesUp(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.scrollUp)
+	return nil
+}
+
+// Scroll down Ps lines (default = 1) (SD)，光标位置不变。
+// xterm 的 CSI Ps ; Ps ; Ps ; Ps ; Ps T 用于鼠标高亮跟踪，此处忽略
+func (vt *virtualTerminal) scrollLinesDown(seq *csiSequence) error {
+	if len(seq.params) > 1 {
+		return nil
 	}
+	vt.cursorChange(seq, vt.scrollDown)
 	return nil
 }
 
 // Delete Ps Character(s) (default = 1) (DCH).
-func (vt *virtualTerminal) deleteChars(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 1)
-	row := vt.getCurrentRow()
-	row.delete(ps)
+func (vt *virtualTerminal) deleteChars(seq *csiSequence) error {
+	vt.cursorChange(seq, func(ps int) {
+		vt.getCurrentRow().delete(vt.x, ps, vt.eraseAttr())
+	})
 	return nil
 }
 
-// Erase Ps Character(s) (default = 1) (ECH).
-func (vt *virtualTerminal) eraseChars(params []rune) error {
-	return vt.deleteChars(params)
+// Erase Ps Character(s) (default = 1) (ECH)，从光标位置开始将字符置为空格，光标位置不变
+func (vt *virtualTerminal) eraseChars(seq *csiSequence) error {
+	vt.cursorChange(seq, func(ps int) {
+		vt.getCurrentRow().erase(vt.x, vt.x+ps, vt.eraseAttr())
+	})
+	return nil
 }
 
 // Character Position Absolute  [column] (default = [rows,1])
-func (vt *virtualTerminal) charPosAbsolute(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 1) - 1
-	vt.moveTo(ps, vt.rows)
+func (vt *virtualTerminal) charPosAbsolute(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 1) - 1
+	vt.setCol(ps)
 	return nil
 }
 
 // Character Position Relative  [columns] (default = [rows,col+1])
-func (vt *virtualTerminal) hPositionRelative(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 1)
+func (vt *virtualTerminal) hPositionRelative(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 1)
 	vt.move(ps, 0)
 	return nil
 }
 
 // 行定位绝对[ROW]（default = [1，列]）（VPA）。
-func (vt *virtualTerminal) linePosAbsolute(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 1) - 1
-	vt.setRow(ps)
+func (vt *virtualTerminal) linePosAbsolute(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 1) - 1
+	vt.moveToOrigin(vt.x, ps)
 	return nil
 }
 
 // Line Position Relative  [rowList] (default = [rows+1,column])
-func (vt *virtualTerminal) vPositionRelative(params []rune) error {
-	ps := vt.getNumberOrDefault(params, 0, 1)
-	vt.moveTo(0, ps)
+func (vt *virtualTerminal) vPositionRelative(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 1)
+	vt.move(0, ps)
 	return nil
 }
 
 // Horizontal and Vertical Position [rows;column] (default = [1,1]) (HVP).
-func (vt *virtualTerminal) hVPosition(params []rune) error {
-	return vt.cursorPosition(params)
+func (vt *virtualTerminal) hVPosition(seq *csiSequence) error {
+	return vt.cursorPosition(seq)
 }
 
 /**
@@ -194,72 +244,187 @@ func (vt *virtualTerminal) hVPosition(params []rune) error {
  * | 12    | Send/receive (SRM). Always off.        | #N      |
  * | 20    | Automatic Newline (LNM). Always off.   | #N      |
  */
-func (vt *virtualTerminal) setMode(params []rune) error {
-	for _, param := range params {
-		ps := vt.getNumberOrDefault([]rune{param}, 0, 0)
-		if ps == 4 {
-			vt.insertMode = true
-			break
-		}
+func (vt *virtualTerminal) setMode(seq *csiSequence) error {
+	for _, ps := range seq.getNumbers(0) {
+		vt.changeMode(ps, true)
+	}
+	return nil
+}
+
+// CSI Pm l  Reset Mode (RM).
+func (vt *virtualTerminal) resetMode(seq *csiSequence) error {
+	for _, ps := range seq.getNumbers(0) {
+		vt.changeMode(ps, false)
+	}
+	return nil
+}
+
+func (vt *virtualTerminal) changeMode(ps int, enable bool) {
+	switch ps {
+	case 4: // insert Mode (IRM).
+		vt.insertMode = enable
+	}
+}
+
+// CSI ? Pm h  DEC Private Mode Set (DECSET).
+func (vt *virtualTerminal) setPrivateMode(seq *csiSequence) error {
+	for _, ps := range seq.getNumbers(0) {
+		vt.changePrivateMode(ps, true)
 	}
 	return nil
 }
 
-func (vt *virtualTerminal) resetMode(params []rune) error {
-	for _, param := range params {
-		ps := vt.getNumberOrDefault([]rune{param}, 0, 0)
-		if ps == 4 {
-			vt.insertMode = false
-			break
-		}
+// CSI ? Pm l  DEC Private Mode Reset (DECRST).
+func (vt *virtualTerminal) resetPrivateMode(seq *csiSequence) error {
+	for _, ps := range seq.getNumbers(0) {
+		vt.changePrivateMode(ps, false)
 	}
 	return nil
 }
 
+// CSI s  Save cursor, available only when DECLRMM is disabled (SCOSC).
+func (vt *virtualTerminal) saveCursorPosition(seq *csiSequence) error {
+	vt.saveCursor()
+	return nil
+}
+
+// CSI u  Restore cursor (SCORC).
+func (vt *virtualTerminal) restoreCursorPosition(seq *csiSequence) error {
+	vt.restoreCursor()
+	return nil
+}
+
 // Set Scrolling Region [top;bottom] (default = full size of window) (DECSTBM), VT100.
-func (vt *virtualTerminal) setScrollRegion(params []rune) error {
-	top := vt.getNumberOrDefault(params, 0, 1)
-	bottom := vt.getNumberOrDefault(params, 1, 0)
-	if len(params) < 2 || bottom > len(vt.rowList) || bottom == 0 {
-		bottom = len(vt.rowList)
+func (vt *virtualTerminal) setScrollRegion(seq *csiSequence) error {
+	top := seq.getNumberOrDefault(0, 1)
+	bottom := seq.getNumberOrDefault(1, vt.rows)
+	if top == 0 {
+		top = 1
+	}
+	if bottom == 0 || bottom > vt.rows {
+		bottom = vt.rows
 	}
+	// 滚动区域至少需要两行，否则忽略
 	if bottom > top {
-		vt.moveTo(0, 0)
+		vt.top = top - 1
+		vt.bottom = bottom - 1
+		vt.resetCursor()
 	}
 	return nil
 }
 
+// 清除从光标位置到屏幕末尾的部分
 func (vt *virtualTerminal) eraseBelow() error {
-	if len(vt.rowList) > vt.rows {
-		vt.rowList = vt.rowList[:vt.rows]
+	vt.eraseRight()
+	for i := vt.y + 1; i < vt.rows; i++ {
+		vt.screen[i] = vt.blankRow()
 	}
 	return nil
 }
 
+// 清除从屏幕开头到光标位置的部分（包含光标所在字符）
 func (vt *virtualTerminal) eraseAbove() error {
-	vt.rowList = vt.rowList[vt.rows-1:]
+	for i := 0; i < vt.y; i++ {
+		vt.screen[i] = vt.blankRow()
+	}
+	vt.getCurrentRow().eraseLeft(vt.x, vt.eraseAttr())
+	return nil
+}
+
+// 清除整个屏幕前先将主屏幕的内容保存到 scrollback，避免 clear 之后丢失历史记录
+func (vt *virtualTerminal) eraseDisplay() error {
+	if vt.altActive {
+		vt.captureFrame()
+	} else {
+		vt.scrollback.push(vt.screen[:usedRows(vt.screen)]...)
+	}
+	for i := range vt.screen {
+		vt.screen[i] = vt.blankRow()
+	}
 	return nil
 }
 
-func (vt *virtualTerminal) eraseAll() error {
-	vt.rowList = nil
-	vt.resetCursor()
+// Erase Saved Lines (xterm)，清除 scrollback
+func (vt *virtualTerminal) eraseSavedLines() error {
+	vt.scrollback.clear()
 	return nil
 }
 
+// 清除从光标位置到行尾的部分（包含光标所在字符）
 func (vt *virtualTerminal) eraseRight() error {
 	row := vt.getCurrentRow()
-	row.eraseRight()
+	row.eraseRight(vt.x, vt.eraseAttr())
+	row.unwrap()
 	return nil
 }
 
+// 清除从行首到光标位置的部分（包含光标所在字符）
 func (vt *virtualTerminal) eraseLeft() error {
+	vt.getCurrentRow().eraseLeft(vt.x, vt.eraseAttr())
+	return nil
+}
+
+// 清除光标所在的整行，光标位置不变
+func (vt *virtualTerminal) eraseLine() error {
+	vt.screen[vt.y] = vt.blankRow()
+	return nil
+}
+
+// CSI ? Ps J  Erase in Display (DECSED)，与 ED 相同，但只清除未受保护的字符
+func (vt *virtualTerminal) selectiveEraseInDisplay(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 0)
+	switch ps {
+	case 0:
+		vt.getCurrentRow().selectiveErase(vt.x, vt.cols)
+		vt.selectiveEraseRows(vt.y+1, vt.rows)
+	case 1:
+		vt.selectiveEraseRows(0, vt.y)
+		vt.getCurrentRow().selectiveErase(0, vt.x+1)
+	case 2:
+		vt.selectiveEraseRows(0, vt.rows)
+	}
+	return nil
+}
+
+// CSI ? Ps K  Erase in Line (DECSEL)，与 EL 相同，但只清除未受保护的字符
+func (vt *virtualTerminal) selectiveEraseInLine(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 0)
 	row := vt.getCurrentRow()
-	row.eraseLeft()
+	switch ps {
+	case 0:
+		row.selectiveErase(vt.x, vt.cols)
+	case 1:
+		row.selectiveErase(0, vt.x+1)
+	case 2:
+		row.selectiveErase(0, vt.cols)
+	}
+	return nil
+}
+
+func (vt *virtualTerminal) selectiveEraseRows(from, to int) {
+	for i := from; i < to; i++ {
+		vt.screen[i].selectiveErase(0, vt.cols)
+	}
+}
+
+/**
+ * CSI Ps " q  Select character protection attribute (DECSCA).
+ *     Ps = 0  -> DECSED and DECSEL can erase (default).
+ *     Ps = 1  -> DECSED and DECSEL cannot erase.
+ *     Ps = 2  -> DECSED and DECSEL can erase.
+ */
+func (vt *virtualTerminal) charProtectionAttribute(seq *csiSequence) error {
+	switch seq.getNumberOrDefault(0, 0) {
+	case 0, 2:
+		vt.protected = false
+	case 1:
+		vt.protected = true
+	}
 	return nil
 }
 
-func (vt *virtualTerminal) charAttributes(params []rune) error {
-	// 忽略字符的颜色属性
+// Character Attributes (SGR).
+func (vt *virtualTerminal) charAttributes(seq *csiSequence) error {
+	vt.attr.apply(seq.params)
 	return nil
 }
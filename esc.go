@@ -0,0 +1,84 @@
+package vt
+
+import "fmt"
+
+// https://zh.wikipedia.org/zh/ANSI%E8%BD%AC%E4%B9%89%E5%BA%8F%E5%88%97
+func (vt *virtualTerminal) escDispatch(intermediates []rune, final rune) {
+	if len(intermediates) > 0 {
+		vt.escIntermediateDispatch(intermediates, final)
+		return
+	}
+	switch final {
+	case '7': // DECSC – 保存光标（Save Cursor）
+		vt.saveCursor()
+	case '8': // DECRC – 恢复光标（Restore Cursor）
+		vt.restoreCursor()
+	case '=': // DECKPAM – 小键盘应用模式（Application Keypad）
+		vt.modes[ModeKeypadApplication] = true
+	case '>': // DECKPNM – 小键盘数字模式（Normal Keypad）
+		vt.modes[ModeKeypadApplication] = false
+	case 'D': // IND – 换行，不改变所在的列（Index）
+		vt.lineFeed()
+	case 'E': // NEL – 移动到下一行的开头（Next Line）
+		vt.setCol(0)
+		vt.lineFeed()
+	case 'N': // SS2 – 下一个字符使用 G2 字符集（Single Shift 2）
+		vt.setSingleShift(2)
+	case 'O': // SS3 – 下一个字符使用 G3 字符集（Single Shift 3）
+		vt.setSingleShift(3)
+	case 'H': // HTS – 设置制表位（Horizontal Tab Set）
+		vt.setTabStop()
+	case 'M': // RI – 反向换行（Reverse Index）
+		vt.reverseIndex()
+	case 'Z': // DECID – 返回终端标识，与 DA1 相同（Return Terminal ID）
+		vt.reply(primaryDeviceAttributes)
+	case 'c': // RIS – 完全重置（Reset to Initial State）
+		vt.fullReset()
+	case 'n': // LS2 – G2 字符集映射到 GL（Locking Shift 2）
+		vt.invokeCharset(2)
+	case 'o': // LS3 – G3 字符集映射到 GL（Locking Shift 3）
+		vt.invokeCharset(3)
+	case '\\': // ST – 字符串终止符（String Terminator），OSC 和 DCS 已在解析时处理
+	default:
+		vt.log(fmt.Sprintf("unsupported esc sequence %q", final))
+	}
+}
+
+// 带有中间字符的 ESC 序列
+func (vt *virtualTerminal) escIntermediateDispatch(intermediates []rune, final rune) {
+	switch string(intermediates) {
+	case "#":
+		if final == '8' { // DECALN – 屏幕校准测试（Screen Alignment Pattern）
+			vt.screenAlignment()
+			return
+		}
+	case "(", ")", "*", "+": // SCS – 指定 G0-G3 字符集（94字符集）
+		vt.designateCharset(int(intermediates[0]-'('), final)
+		return
+	case "-", ".", "/": // SCS – 指定 G1-G3 字符集（96字符集）
+		vt.designateCharset(int(intermediates[0]-'-')+1, final)
+		return
+	case "%", " ": // 选择 UTF-8 字符集、7位或8位控制字符，始终使用 UTF-8 和7位控制字符
+		return
+	}
+	vt.log(fmt.Sprintf("unsupported esc sequence %q", string(intermediates)+string(final)))
+}
+
+// 完全重置终端，屏幕上的内容与 CSI 2J 一样保存到 scrollback
+func (vt *virtualTerminal) fullReset() {
+	vt.scrollback.push(vt.mainScreen[:usedRows(vt.mainScreen)]...)
+	vt.resetState()
+}
+
+// ESC # 8  DEC Screen Alignment Test (DECALN)，用 E 填满屏幕，重置滚动区域，光标移动到左上角
+func (vt *virtualTerminal) screenAlignment() {
+	for _, row := range vt.screen {
+		for col := 0; col < vt.cols; col++ {
+			row.set(col, 'E', 1, Cell{})
+		}
+		row.unwrap()
+	}
+	vt.resetScrollRegion()
+	vt.modes[ModeOrigin] = false
+	vt.moveTo(0, 0)
+}
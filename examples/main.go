@@ -795,12 +795,22 @@ var data = `{"version": 2, "width": 81, "height": 20}
 [119.2079330000001, "o", "\r\n"]
 `
 
-func readInputContent() ([]byte, error) {
+type header struct {
+	Version int `json:"version"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+}
+
+func readInputContent() (*header, []byte, error) {
 	_lines := strings.Split(data, "\n")
 
+	var h header
 	var inputs []byte
 	for i, line := range _lines {
 		if i == 0 {
+			if err := json.Unmarshal([]byte(line), &h); err != nil {
+				return nil, nil, err
+			}
 			continue
 		}
 		if line == "" {
@@ -808,22 +818,22 @@ func readInputContent() ([]byte, error) {
 		}
 		var arr []interface{}
 		if err := json.Unmarshal([]byte(line), &arr); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		inputs = append(inputs, []byte(arr[2].(string))...)
 	}
-	return inputs, nil
+	return &h, inputs, nil
 }
 
 func main() {
-	content, err := readInputContent()
+	h, content, err := readInputContent()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	v := vt.New()
+	v := vt.New(h.Width, h.Height)
 	v.Advance(content)
-	lines := v.Parse()
+	lines := v.Output()
 	for _, line := range lines {
 		println(line)
 	}
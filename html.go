@@ -0,0 +1,174 @@
+package vt
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultForeground = "#e5e5e5" // 默认前景色
+	defaultBackground = "#000000" // 默认背景色
+)
+
+// xterm 的16色调色板
+var basicColors = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// 渲染为链接的 URI scheme，其余的超链接（例如 javascript:）只保留文字
+var linkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"ftp":    true,
+	"file":   true,
+	"mailto": true,
+}
+
+// RenderHTML 将行渲染为 HTML，自动换行的行会被合并，超链接渲染为 a 元素
+func RenderHTML(rows []*Row) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<pre style="color:%s;background-color:%s">`, defaultForeground, defaultBackground)
+	var cells []Cell
+	for i, row := range rows {
+		if row.wrapped && i < len(rows)-1 {
+			cells = append(cells, row.cells[:row.wrapEnd()]...)
+			continue
+		}
+		cells = append(cells, row.cells...)
+		renderCells(&b, trimCells(cells))
+		if i < len(rows)-1 {
+			b.WriteString("\n")
+		}
+		cells = cells[:0]
+	}
+	b.WriteString("</pre>")
+	return b.String()
+}
+
+// 去除行尾没有显示属性和超链接的空白
+func trimCells(cells []Cell) []Cell {
+	n := len(cells)
+	for n > 0 && cells[n-1].IsBlank() && cells[n-1].Attr == (Attr{}) && cells[n-1].Link == nil {
+		n--
+	}
+	return cells[:n]
+}
+
+func renderCells(b *strings.Builder, cells []Cell) {
+	var link *Hyperlink
+	var style string
+	for i, cell := range cells {
+		if i == 0 || cell.Link != link {
+			if style != "" {
+				b.WriteString("</span>")
+			}
+			if linkHref(link) != "" {
+				b.WriteString("</a>")
+			}
+			link, style = cell.Link, ""
+			if href := linkHref(link); href != "" {
+				fmt.Fprintf(b, `<a href="%s">`, html.EscapeString(href))
+			}
+			if style = cell.Attr.style(); style != "" {
+				fmt.Fprintf(b, `<span style="%s">`, style)
+			}
+		} else if s := cell.Attr.style(); s != style {
+			if style != "" {
+				b.WriteString("</span>")
+			}
+			if style = s; style != "" {
+				fmt.Fprintf(b, `<span style="%s">`, style)
+			}
+		}
+		b.WriteString(html.EscapeString(cell.Text))
+	}
+	if style != "" {
+		b.WriteString("</span>")
+	}
+	if linkHref(link) != "" {
+		b.WriteString("</a>")
+	}
+}
+
+// 超链接的地址，不允许的 scheme 返回空字符串
+func linkHref(link *Hyperlink) string {
+	if link == nil {
+		return ""
+	}
+	u, err := url.Parse(link.URI)
+	if err != nil || !linkSchemes[strings.ToLower(u.Scheme)] {
+		return ""
+	}
+	return link.URI
+}
+
+// 显示属性对应的 CSS
+func (a Attr) style() string {
+	var styles []string
+	fg, bg := a.Fg.css(defaultForeground), a.Bg.css(defaultBackground)
+	if a.Inverse {
+		fg, bg = bg, fg
+	}
+	if fg != defaultForeground {
+		styles = append(styles, "color:"+fg)
+	}
+	if bg != defaultBackground {
+		styles = append(styles, "background-color:"+bg)
+	}
+	if a.Bold {
+		styles = append(styles, "font-weight:bold")
+	}
+	if a.Dim {
+		styles = append(styles, "opacity:0.5")
+	}
+	if a.Italic {
+		styles = append(styles, "font-style:italic")
+	}
+	var decorations []string
+	if a.Underline != UnderlineNone {
+		decorations = append(decorations, "underline")
+	}
+	if a.Strikethrough {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		styles = append(styles, "text-decoration:"+strings.Join(decorations, " "))
+	}
+	switch a.Underline {
+	case UnderlineDouble:
+		styles = append(styles, "text-decoration-style:double")
+	case UnderlineCurly:
+		styles = append(styles, "text-decoration-style:wavy")
+	case UnderlineDotted:
+		styles = append(styles, "text-decoration-style:dotted")
+	case UnderlineDashed:
+		styles = append(styles, "text-decoration-style:dashed")
+	}
+	if a.Hidden {
+		styles = append(styles, "visibility:hidden")
+	}
+	return strings.Join(styles, ";")
+}
+
+// 颜色对应的 CSS，默认颜色使用 def
+func (c Color) css(def string) string {
+	switch {
+	case c.Type == ColorDefault:
+		return def
+	case c.Type == ColorRGB:
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	case c.Index < 16:
+		return basicColors[c.Index]
+	case c.Index < 232:
+		// 6x6x6 的颜色立方
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		i := int(c.Index) - 16
+		return fmt.Sprintf("#%02x%02x%02x", levels[i/36], levels[i/6%6], levels[i%6])
+	}
+	// 24级灰度
+	gray := 8 + 10*(int(c.Index)-232)
+	return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+}
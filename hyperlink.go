@@ -0,0 +1,59 @@
+package vt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hyperlink OSC 8 设置的超链接，同一个超链接覆盖的单元共享同一个 Hyperlink
+type Hyperlink struct {
+	URI string
+	ID  string // 应用程序指定的 id，相同 id 和 URI 的文字属于同一个链接，例如被换行拆开的链接
+}
+
+// LinkRun 行内连续的带有相同超链接的单元
+type LinkRun struct {
+	Link  Hyperlink
+	Start int    // 第一列
+	End   int    // 最后一列之后的一列
+	Text  string // 链接的文字
+}
+
+// OSC 8 ; params ; URI  开始一个超链接，URI 为空时结束超链接。
+// params 为以冒号分隔的 key=value，目前只使用 id
+func (vt *virtualTerminal) setHyperlink(pt string) {
+	params, uri, ok := strings.Cut(pt, string(_SEMICOLON))
+	if !ok {
+		vt.log(fmt.Sprintf("invalid hyperlink %q", pt))
+		return
+	}
+	if uri == "" {
+		vt.link = nil
+		return
+	}
+	link := &Hyperlink{URI: uri}
+	for _, param := range strings.Split(params, ":") {
+		if id, ok := strings.CutPrefix(param, "id="); ok {
+			link.ID = id
+		}
+	}
+	vt.link = link
+}
+
+// Links 返回该行中的超链接，按列的顺序排列
+func (r *Row) Links() []LinkRun {
+	var runs []LinkRun
+	for i := 0; i < len(r.cells); i++ {
+		link := r.cells[i].Link
+		if link == nil {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].End == i && runs[n-1].Link == *link {
+			runs[n-1].End = i + 1
+			runs[n-1].Text += r.cells[i].Text
+			continue
+		}
+		runs = append(runs, LinkRun{Link: *link, Start: i, End: i + 1, Text: r.cells[i].Text})
+	}
+	return runs
+}
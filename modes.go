@@ -0,0 +1,185 @@
+package vt
+
+import "fmt"
+
+// Mode DEC 私有模式的编号，通过 CSI ? Pm h 设置，CSI ? Pm l 重置
+type Mode int
+
+const (
+	ModeCursorKeys         Mode = 1    // 应用程序光标键（DECCKM）
+	ModeOrigin             Mode = 6    // 原点模式，光标位置相对于滚动区域（DECOM）
+	ModeAutoWrap           Mode = 7    // 自动换行（DECAWM）
+	ModeMouseX10           Mode = 9    // X10 鼠标上报
+	ModeCursorBlink        Mode = 12   // 光标闪烁
+	ModeCursorVisible      Mode = 25   // 显示光标（DECTCEM）
+	ModeKeypadApplication  Mode = 66   // 小键盘应用模式（DECNKM），也可以由 ESC = 和 ESC > 设置
+	ModeAltScreen          Mode = 47   // 备用屏幕
+	ModeMouseNormal        Mode = 1000 // 鼠标按下和释放上报
+	ModeMouseHighlight     Mode = 1001 // 鼠标高亮跟踪
+	ModeMouseButtonEvent   Mode = 1002 // 鼠标按下时的移动上报
+	ModeMouseAnyEvent      Mode = 1003 // 所有鼠标移动上报
+	ModeFocusEvents        Mode = 1004 // 焦点变化上报
+	ModeMouseUTF8          Mode = 1005 // UTF-8 鼠标编码
+	ModeMouseSGR           Mode = 1006 // SGR 鼠标编码
+	ModeMouseURXVT         Mode = 1015 // urxvt 鼠标编码
+	ModeMouseSGRPixels     Mode = 1016 // SGR 像素鼠标编码
+	ModeAltScreenClear     Mode = 1047 // 备用屏幕，切换回主屏幕前清除
+	ModeSaveCursor         Mode = 1048 // 保存光标
+	ModeAltScreenSave      Mode = 1049 // 保存光标并切换到备用屏幕
+	ModeBracketedPaste     Mode = 2004 // 括号粘贴
+	ModeSynchronizedOutput Mode = 2026 // 同步输出
+)
+
+// 支持的 DEC 私有模式及其默认值
+var defaultModes = map[Mode]bool{
+	ModeCursorKeys:         false,
+	ModeOrigin:             false,
+	ModeAutoWrap:           true,
+	ModeMouseX10:           false,
+	ModeCursorBlink:        false,
+	ModeCursorVisible:      true,
+	ModeKeypadApplication:  false,
+	ModeAltScreen:          false,
+	ModeMouseNormal:        false,
+	ModeMouseHighlight:     false,
+	ModeMouseButtonEvent:   false,
+	ModeMouseAnyEvent:      false,
+	ModeFocusEvents:        false,
+	ModeMouseUTF8:          false,
+	ModeMouseSGR:           false,
+	ModeMouseURXVT:         false,
+	ModeMouseSGRPixels:     false,
+	ModeAltScreenClear:     false,
+	ModeSaveCursor:         false,
+	ModeAltScreenSave:      false,
+	ModeBracketedPaste:     false,
+	ModeSynchronizedOutput: false,
+}
+
+// 互斥的模式，设置其中一个时重置其余的
+var (
+	mouseTrackingModes = []Mode{ModeMouseX10, ModeMouseNormal, ModeMouseHighlight, ModeMouseButtonEvent, ModeMouseAnyEvent}
+	mouseEncodingModes = []Mode{ModeMouseUTF8, ModeMouseSGR, ModeMouseURXVT, ModeMouseSGRPixels}
+)
+
+// DECRQM 的应答值
+const (
+	modeNotRecognized    = 0
+	modeSet              = 1
+	modeReset            = 2
+	modePermanentlySet   = 3
+	modePermanentlyReset = 4
+)
+
+func newModes() map[Mode]bool {
+	modes := make(map[Mode]bool, len(defaultModes))
+	for mode, value := range defaultModes {
+		modes[mode] = value
+	}
+	return modes
+}
+
+// 获取 DEC 私有模式的状态，不支持的模式返回 false
+func (vt *virtualTerminal) mode(mode Mode) bool {
+	return vt.modes[mode]
+}
+
+func (vt *virtualTerminal) changePrivateMode(ps int, enable bool) {
+	mode := Mode(ps)
+	if _, ok := vt.modes[mode]; !ok {
+		vt.log(fmt.Sprintf("unsupported private mode %d", ps))
+		return
+	}
+	if enable {
+		for _, group := range [][]Mode{mouseTrackingModes, mouseEncodingModes} {
+			if containsMode(group, mode) {
+				for _, m := range group {
+					vt.modes[m] = false
+				}
+			}
+		}
+	}
+	vt.modes[mode] = enable
+
+	switch mode {
+	case ModeOrigin:
+		vt.resetCursor()
+	case ModeAutoWrap:
+		vt.wrapPending = false
+	case ModeAltScreen:
+		if enable {
+			vt.useAlternateScreen(false)
+		} else {
+			vt.useMainScreen(false)
+		}
+	case ModeAltScreenClear: // 切换回主屏幕前清除备用屏幕
+		if enable {
+			vt.useAlternateScreen(false)
+		} else {
+			vt.useMainScreen(true)
+		}
+	case ModeSaveCursor:
+		if enable {
+			vt.saveCursor()
+		} else {
+			vt.restoreCursor()
+		}
+	case ModeAltScreenSave: // Save cursor as in DECSC, switch to Alternate Screen Buffer and clear it.
+		if enable {
+			vt.saveCursor()
+			vt.useAlternateScreen(true)
+		} else {
+			vt.useMainScreen(false)
+			vt.restoreCursor()
+		}
+	}
+}
+
+func containsMode(modes []Mode, mode Mode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// CSI ? Ps $ p  Request DEC private mode (DECRQM).
+// 应答 CSI ? Ps ; Pm $ y，Pm 为 0 不支持，1 已设置，2 已重置
+func (vt *virtualTerminal) requestPrivateMode(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 0)
+	value, ok := vt.modes[Mode(ps)]
+	switch Mode(ps) {
+	case ModeAltScreen, ModeAltScreenClear, ModeAltScreenSave:
+		value = vt.altActive
+	}
+	pm := modeNotRecognized
+	if ok {
+		pm = modeReset
+		if value {
+			pm = modeSet
+		}
+	}
+	vt.reply(fmt.Sprintf("\x1b[?%d;%d$y", ps, pm))
+	return nil
+}
+
+// CSI Ps $ p  Request ANSI mode (DECRQM).
+// 应答 CSI Ps ; Pm $ y，KAM 始终开启，SRM 和 LNM 始终关闭
+func (vt *virtualTerminal) requestMode(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(0, 0)
+	pm := modeNotRecognized
+	switch ps {
+	case 2: // Keyboard Action Mode (KAM).
+		pm = modePermanentlySet
+	case 4: // insert Mode (IRM).
+		pm = modeReset
+		if vt.insertMode {
+			pm = modeSet
+		}
+	case 12, 20: // Send/receive (SRM), Automatic Newline (LNM).
+		pm = modePermanentlyReset
+	}
+	vt.reply(fmt.Sprintf("\x1b[%d;%d$y", ps, pm))
+	return nil
+}
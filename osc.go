@@ -0,0 +1,40 @@
+package vt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 启动操作系统使用的控制字符串。OSC序列与CSI序列相似，但不限于整数参数。
+// 通常，这些控制序列由ST终止[12]:8.3.89。
+// 在xterm中，它们也可能被BEL终止[13]。
+// 例如，在xterm中，窗口标题可以这样设置：OSC 0;this is the window title _BEL。
+func (vt *virtualTerminal) handleOSCSequence(data string) {
+	ps, pt, ok := strings.Cut(data, string(_SEMICOLON))
+	if !ok {
+		return
+	}
+	osc, err := strconv.Atoi(ps)
+	if err != nil {
+		vt.log(fmt.Sprintf("invalid osc sequence %q", data))
+		return
+	}
+	switch osc {
+	case 0: // 设置窗口标题和图标名称
+		vt.setIconName(pt)
+		vt.setTitle(pt)
+	case 1: // 设置图标名称
+		vt.setIconName(pt)
+	case 2: // 设置窗口标题
+		vt.setTitle(pt)
+	case 7:
+		vt.setWorkingDirectory(pt)
+	case 8:
+		vt.setHyperlink(pt)
+	case 133:
+		vt.handleShellIntegration(pt)
+	case 1337:
+		vt.handleITermSequence(pt)
+	}
+}
@@ -0,0 +1,336 @@
+package vt
+
+import "unicode/utf8"
+
+// 参考 Paul Williams 的 DEC 兼容解析器状态机 https://vt100.net/emu/dec_ansi_parser
+// 与原始状态机不同的是，输入先按 UTF-8 解码为字符再进入状态机，
+// 不完整的 UTF-8 字节和未结束的控制序列都会保留到下一次 advance。
+type parserState uint8
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSIEntry
+	stateCSIParam
+	stateCSIIntermediate
+	stateCSIIgnore
+	stateDCSEntry
+	stateDCSParam
+	stateDCSIntermediate
+	stateDCSPassthrough
+	stateDCSIgnore
+	stateOSCString
+	stateSOSPMAPCString
+)
+
+const (
+	_CAN rune = 0x18 // Cancel，中断当前控制序列
+	_SUB rune = 0x1a // Substitute，中断当前控制序列
+
+	_DCS rune = 0x90 // Device Control String，等同于 ESC P
+	_SOS rune = 0x98 // Start of String，等同于 ESC X
+	_CSI rune = 0x9b // Control Sequence Introducer，等同于 ESC [
+	_OSC rune = 0x9d // Operating System Command，等同于 ESC ]
+	_PM  rune = 0x9e // Privacy Message，等同于 ESC ^
+	_APC rune = 0x9f // Application Program Command，等同于 ESC _
+
+	maxParamsLength = 256  // 控制序列参数的最大长度，超出部分被忽略
+	maxStringLength = 8192 // OSC 和 DCS 数据的最大长度，超出部分被忽略
+)
+
+// parserHandler 接收解析器识别出的字符和控制序列
+type parserHandler interface {
+	// 可显示字符
+	print(code rune)
+	// C0 控制字符
+	execute(code rune)
+	// ESC 序列，intermediates 为 0x20-0x2F 范围内的中间字符
+	escDispatch(intermediates []rune, final rune)
+	// CSI 序列，params 包含私有前缀，例如 CSI ? 25 h 中的 ?25
+	csiDispatch(params, intermediates []rune, final rune)
+	// OSC 序列，data 为 OSC 与终止符之间的内容
+	oscDispatch(data []rune)
+	// DCS 序列，data 为最终字符与终止符之间的内容
+	dcsDispatch(params, intermediates []rune, final rune, data []rune)
+}
+
+type parser struct {
+	handler parserHandler
+	state   parserState
+
+	pending       []byte // 上一次 advance 末尾不完整的 UTF-8 字节
+	offset        int64  // 已处理的输入字节数
+	start         int64  // 当前控制序列的 ESC 在输入中的字节偏移
+	params        []rune
+	intermediates []rune
+	final         rune   // DCS 的最终字符
+	data          []rune // OSC 或 DCS 的数据
+}
+
+func newParser(handler parserHandler) *parser {
+	return &parser{handler: handler}
+}
+
+func (p *parser) reset() {
+	p.state = stateGround
+	p.pending = nil
+	p.offset = 0
+	p.start = 0
+	p.clear()
+}
+
+func (p *parser) clear() {
+	p.params = p.params[:0]
+	p.intermediates = p.intermediates[:0]
+	p.final = 0
+	p.data = p.data[:0]
+}
+
+func (p *parser) advance(inputs []byte) {
+	if len(p.pending) > 0 {
+		inputs = append(p.pending, inputs...)
+		p.pending = nil
+	}
+	for len(inputs) > 0 {
+		if !utf8.FullRune(inputs) {
+			p.pending = append([]byte(nil), inputs...)
+			return
+		}
+		code, size := utf8.DecodeRune(inputs)
+		inputs = inputs[size:]
+		p.offset += int64(size)
+		p.next(code)
+	}
+}
+
+func (p *parser) next(code rune) {
+	// 在任何状态下都有效的字符
+	switch code {
+	case _CAN, _SUB:
+		p.state = stateGround
+		return
+	case _ESC:
+		p.exitString()
+		p.start = p.offset - 1
+		p.enter(stateEscape)
+		return
+	case _ST:
+		p.exitString()
+		p.state = stateGround
+		return
+	}
+	if isC1Control(code) {
+		p.exitString()
+		p.start = p.offset - int64(utf8.RuneLen(code))
+		p.c1(code)
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		if isC0Sequence(code) {
+			p.handler.execute(code)
+		} else {
+			p.handler.print(code)
+		}
+	case stateEscape:
+		switch {
+		case isC0Sequence(code):
+			p.execute(code)
+		case isIntermediate(code):
+			p.collect(code)
+			p.state = stateEscapeIntermediate
+		case code == '[':
+			p.enter(stateCSIEntry)
+		case code == ']':
+			p.enter(stateOSCString)
+		case code == 'P':
+			p.enter(stateDCSEntry)
+		case code == 'X', code == '^', code == '_':
+			p.enter(stateSOSPMAPCString)
+		case code >= 0x30 && code <= 0x7e:
+			p.handler.escDispatch(p.intermediates, code)
+			p.state = stateGround
+		case code != _DEL:
+			p.state = stateGround
+		}
+	case stateEscapeIntermediate:
+		switch {
+		case isC0Sequence(code):
+			p.execute(code)
+		case isIntermediate(code):
+			p.collect(code)
+		case code >= 0x30 && code <= 0x7e:
+			p.handler.escDispatch(p.intermediates, code)
+			p.state = stateGround
+		case code != _DEL:
+			p.state = stateGround
+		}
+	case stateCSIEntry, stateCSIParam:
+		switch {
+		case isC0Sequence(code):
+			p.execute(code)
+		case isParam(code):
+			p.param(code)
+			p.state = stateCSIParam
+		case isPrivateMarker(code):
+			if p.state == stateCSIParam {
+				p.state = stateCSIIgnore
+				return
+			}
+			p.param(code)
+			p.state = stateCSIParam
+		case isIntermediate(code):
+			p.collect(code)
+			p.state = stateCSIIntermediate
+		case isFinal(code):
+			p.handler.csiDispatch(p.params, p.intermediates, code)
+			p.state = stateGround
+		case code != _DEL:
+			p.state = stateCSIIgnore
+		}
+	case stateCSIIntermediate:
+		switch {
+		case isC0Sequence(code):
+			p.execute(code)
+		case isIntermediate(code):
+			p.collect(code)
+		case isFinal(code):
+			p.handler.csiDispatch(p.params, p.intermediates, code)
+			p.state = stateGround
+		case code != _DEL:
+			p.state = stateCSIIgnore
+		}
+	case stateCSIIgnore:
+		switch {
+		case isC0Sequence(code):
+			p.execute(code)
+		case isFinal(code):
+			p.state = stateGround
+		}
+	case stateDCSEntry, stateDCSParam:
+		switch {
+		case isParam(code):
+			p.param(code)
+			p.state = stateDCSParam
+		case isPrivateMarker(code):
+			if p.state == stateDCSParam {
+				p.state = stateDCSIgnore
+				return
+			}
+			p.param(code)
+			p.state = stateDCSParam
+		case isIntermediate(code):
+			p.collect(code)
+			p.state = stateDCSIntermediate
+		case isFinal(code):
+			p.final = code
+			p.state = stateDCSPassthrough
+		}
+	case stateDCSIntermediate:
+		switch {
+		case isIntermediate(code):
+			p.collect(code)
+		case isFinal(code):
+			p.final = code
+			p.state = stateDCSPassthrough
+		case code >= 0x30 && code < 0x40:
+			p.state = stateDCSIgnore
+		}
+	case stateDCSPassthrough, stateOSCString:
+		if p.state == stateOSCString && code == _BEL {
+			// xterm 允许使用 BEL 结束 OSC
+			p.exitString()
+			p.state = stateGround
+			return
+		}
+		if isC0Sequence(code) && p.state == stateOSCString {
+			return
+		}
+		if len(p.data) < maxStringLength {
+			p.data = append(p.data, code)
+		}
+	case stateDCSIgnore, stateSOSPMAPCString:
+		// 忽略直到 ST
+	}
+}
+
+// C1 控制字符与对应的7位 ESC 序列相同，例如 0x9b 等同于 ESC [
+func (p *parser) c1(code rune) {
+	switch code {
+	case _CSI:
+		p.enter(stateCSIEntry)
+	case _OSC:
+		p.enter(stateOSCString)
+	case _DCS:
+		p.enter(stateDCSEntry)
+	case _SOS, _PM, _APC:
+		p.enter(stateSOSPMAPCString)
+	default:
+		p.clear()
+		p.handler.escDispatch(p.intermediates, code-0x40)
+		p.state = stateGround
+	}
+}
+
+// 进入新的状态并清除之前收集的参数
+func (p *parser) enter(state parserState) {
+	p.clear()
+	p.state = state
+}
+
+// 控制序列中间出现的 C0 控制字符会被立即执行
+func (p *parser) execute(code rune) {
+	if code == _DEL {
+		return
+	}
+	p.handler.execute(code)
+}
+
+// 离开 OSC 或 DCS 状态时分发收集到的数据
+func (p *parser) exitString() {
+	switch p.state {
+	case stateOSCString:
+		p.handler.oscDispatch(p.data)
+	case stateDCSPassthrough:
+		p.handler.dcsDispatch(p.params, p.intermediates, p.final, p.data)
+	}
+}
+
+func (p *parser) param(code rune) {
+	if len(p.params) < maxParamsLength {
+		p.params = append(p.params, code)
+	}
+}
+
+func (p *parser) collect(code rune) {
+	if len(p.intermediates) < maxParamsLength {
+		p.intermediates = append(p.intermediates, code)
+	}
+}
+
+// C1 控制字符 0x80-0x9f
+func isC1Control(code rune) bool {
+	return code >= 0x80 && code <= 0x9f
+}
+
+// 参数字符 0-9 : ;
+func isParam(code rune) bool {
+	return code >= 0x30 && code <= 0x3b
+}
+
+// 私有前缀 < = > ?
+func isPrivateMarker(code rune) bool {
+	return code >= 0x3c && code <= 0x3f
+}
+
+// 中间字符 空格、!"#$%&'()*+,-./
+func isIntermediate(code rune) bool {
+	return code >= 0x20 && code <= 0x2f
+}
+
+// 最终字符 @A–Z[\]^_`a–z{|}~
+func isFinal(code rune) bool {
+	return isCSISequence(code)
+}
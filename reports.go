@@ -0,0 +1,126 @@
+package vt
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// 终端名称，用于 XTVERSION 和 XTGETTCAP 的应答
+	terminalName = "vt-go"
+	// 终端类型，用于 XTGETTCAP 的 TN
+	terminalType = "xterm-256color"
+
+	// DA1 应答：VT220，支持 ANSI 颜色
+	primaryDeviceAttributes = "\x1b[?62;22c"
+	// DA2 应答：VT220，固件版本 10，没有选项
+	secondaryDeviceAttributes = "\x1b[>1;10;0c"
+)
+
+// XTGETTCAP 支持查询的 termcap/terminfo 能力
+var termCapabilities = map[string]string{
+	"TN":     terminalType,
+	"name":   terminalType,
+	"Co":     "256",
+	"colors": "256",
+	"RGB":    "8",
+}
+
+// CSI Ps n  Device Status Report (DSR).
+//
+//	Ps = 5  -> Status Report，应答 CSI 0 n
+//	Ps = 6  -> Report Cursor Position (CPR)，应答 CSI r ; c R
+func (vt *virtualTerminal) deviceStatusReport(seq *csiSequence) error {
+	switch seq.getNumberOrDefault(0, 0) {
+	case 5:
+		vt.reply("\x1b[0n")
+	case 6:
+		row, col := vt.cursorPositionReport()
+		vt.reply(fmt.Sprintf("\x1b[%d;%dR", row, col))
+	}
+	return nil
+}
+
+// CSI ? Ps n  Device Status Report (DEC-specific).
+//
+//	Ps = 6  -> Report Cursor Position (DECXCPR)，应答 CSI ? r ; c ; 1 R
+func (vt *virtualTerminal) privateDeviceStatusReport(seq *csiSequence) error {
+	switch seq.getNumberOrDefault(0, 0) {
+	case 6:
+		row, col := vt.cursorPositionReport()
+		vt.reply(fmt.Sprintf("\x1b[?%d;%d;1R", row, col))
+	}
+	return nil
+}
+
+// 光标位置，从1开始，原点模式（DECOM）下行号相对于滚动区域
+func (vt *virtualTerminal) cursorPositionReport() (row, col int) {
+	row = vt.y + 1
+	if vt.mode(ModeOrigin) {
+		row -= vt.top
+	}
+	return row, vt.x + 1
+}
+
+// CSI Ps c  Send Device Attributes (Primary DA).
+func (vt *virtualTerminal) sendPrimaryDeviceAttributes(seq *csiSequence) error {
+	if seq.getNumberOrDefault(0, 0) == 0 {
+		vt.reply(primaryDeviceAttributes)
+	}
+	return nil
+}
+
+// CSI > Ps c  Send Device Attributes (Secondary DA).
+func (vt *virtualTerminal) sendSecondaryDeviceAttributes(seq *csiSequence) error {
+	if seq.getNumberOrDefault(0, 0) == 0 {
+		vt.reply(secondaryDeviceAttributes)
+	}
+	return nil
+}
+
+// CSI > Ps q  Report xterm name and version (XTVERSION)，应答 DCS > | text ST
+func (vt *virtualTerminal) reportVersion(seq *csiSequence) error {
+	if seq.getNumberOrDefault(0, 0) == 0 {
+		vt.reply("\x1bP>|" + terminalName + "\x1b\\")
+	}
+	return nil
+}
+
+// DCS $ q Pt ST  Request Status String (DECRQSS)。
+// 应答 DCS 1 $ r Pt ST，不支持的请求应答 DCS 0 $ r ST
+func (vt *virtualTerminal) requestStatusString(data string) {
+	var status string
+	switch data {
+	case "m": // SGR
+		status = vt.attr.sgr() + "m"
+	case "r": // DECSTBM
+		status = fmt.Sprintf("%d;%dr", vt.top+1, vt.bottom+1)
+	case "\"q": // DECSCA
+		status = "0\"q"
+		if vt.protected {
+			status = "1\"q"
+		}
+	default:
+		vt.reply("\x1bP0$r\x1b\\")
+		return
+	}
+	vt.reply("\x1bP1$r" + status + "\x1b\\")
+}
+
+// DCS + q Pt ST  Request Termcap/Terminfo String (XTGETTCAP)。
+// Pt 为以分号分隔的十六进制编码的能力名称，应答 DCS 1 + r Pt=Pv ST，
+// 能力名称和值都使用十六进制编码，遇到不支持的能力时应答 DCS 0 + r ST
+func (vt *virtualTerminal) requestTermcapString(data string) {
+	var replies []string
+	for _, field := range strings.Split(data, string(_SEMICOLON)) {
+		name, err := hex.DecodeString(field)
+		value, ok := termCapabilities[string(name)]
+		if err != nil || !ok {
+			vt.reply("\x1bP0+r\x1b\\")
+			return
+		}
+		replies = append(replies, field+"="+strings.ToUpper(hex.EncodeToString([]byte(value))))
+	}
+	vt.reply("\x1bP1+r" + strings.Join(replies, string(_SEMICOLON)) + "\x1b\\")
+}
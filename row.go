@@ -1,48 +1,217 @@
 package vt
 
+import "strings"
+
 type Row struct {
-	data  []rune // 当前行
-	index int
+	cells   []Cell // 当前行，长度固定为屏幕列数
+	wrapped bool   // 是否因自动换行而延续到下一行
+	skipped bool   // 宽字符在最后一列放不下而提前换行，最后一列被跳过
+}
+
+func newRow(cols int) *Row {
+	r := &Row{cells: make([]Cell, cols)}
+	r.erase(0, cols, Attr{})
+	return r
+}
+
+// 设置指定列的字符，显示属性、超链接和保护属性与 pen 相同，宽字符的第二列使用占位单元
+func (r *Row) set(col int, code rune, width int, pen Cell) {
+	if col < 0 || col+width > len(r.cells) {
+		return
+	}
+	r.clearClusters(col, col+width)
+	pen.Text = ""
+	pen.Width = 0
+	for i := col + 1; i < col+width; i++ {
+		r.cells[i] = pen
+	}
+	pen.Text = string(code)
+	pen.Width = width
+	r.cells[col] = pen
+}
+
+// 将字符附加到指定列的单元中组成字素簇，width 大于0且右侧有空间时单元变宽，单元最多占用两列
+func (r *Row) extend(col int, code rune, width int) {
+	cell := &r.cells[col]
+	cell.Text += string(code)
+	end := col + cell.Width
+	if width == 0 || cell.Width+width > 2 || end+width > len(r.cells) {
+		return
+	}
+	r.clearClusters(end, end+width)
+	for i := end; i < end+width; i++ {
+		r.cells[i] = Cell{Width: 0, Attr: cell.Attr, Link: cell.Link, protected: cell.protected}
+	}
+	cell.Width += width
+}
+
+// 覆盖宽字符的一部分时，宽字符的剩余部分变为空白
+func (r *Row) clearClusters(from, to int) {
+	for from > 0 && r.cells[from].Width == 0 {
+		from--
+	}
+	for i := from; i < to && i < len(r.cells); {
+		width := max(r.cells[i].Width, 1)
+		if r.cells[i].Width != 1 {
+			for j := i; j < i+width && j < len(r.cells); j++ {
+				r.cells[j] = blankCell(r.cells[j].Attr)
+			}
+		}
+		i += width
+	}
 }
 
-func (r *Row) setIndex(index int) {
-	r.index = index
+// 向指定列插入n个使用指定显示属性的空格，右侧超出行宽的字符被丢弃
+func (r *Row) insert(col, n int, attr Attr) {
+	if col < 0 || col >= len(r.cells) || n <= 0 {
+		return
+	}
+	if n > len(r.cells)-col {
+		n = len(r.cells) - col
+	}
+	copy(r.cells[col+n:], r.cells[col:])
+	r.erase(col, col+n, attr)
+	r.fixWide()
 }
 
-// 添加新输入的字符
-func (r *Row) append(code rune) {
-	if r.index < len(r.data) {
-		r.data[r.index] = code
-	} else {
-		r.data = append(r.data, code)
+// 从指定列删除n个字符，右侧字符左移，行尾补使用指定显示属性的空格
+func (r *Row) delete(col, n int, attr Attr) {
+	if col < 0 || col >= len(r.cells) || n <= 0 {
+		return
+	}
+	if n > len(r.cells)-col {
+		n = len(r.cells) - col
 	}
-	r.index++
+	copy(r.cells[col:], r.cells[col+n:])
+	r.erase(len(r.cells)-n, len(r.cells), attr)
+	r.fixWide()
 }
 
-// 向下标位置插入字符
-func (r *Row) insert(code ...rune) {
-	for _, c := range code {
-		r.data = insert(r.data, r.index, c)
+// 将 [from, to) 范围内的字符置为使用指定显示属性的空格
+func (r *Row) erase(from, to int, attr Attr) {
+	from = max(from, 0)
+	to = min(to, len(r.cells))
+	for i := from; i < to; i++ {
+		r.cells[i] = blankCell(attr)
 	}
+	r.fixWide()
 }
 
-// 从下标位置删除N个字符
-func (r *Row) delete(ps int) {
-	r.data = remove(r.data, r.index, ps)
+// 将 [from, to) 范围内未受保护的字符置为空格，保留原有的显示属性
+func (r *Row) selectiveErase(from, to int) {
+	from = max(from, 0)
+	to = min(to, len(r.cells))
+	for i := from; i < to; i++ {
+		if !r.cells[i].protected {
+			r.cells[i] = blankCell(r.cells[i].Attr)
+		}
+	}
+	r.fixWide()
 }
 
-// 删除当前光标所在位置右侧的字符
-func (r *Row) eraseRight() {
-	if r.index < len(r.data) {
-		r.data = r.data[:r.index]
+// 插入、删除或清除字符后，被拆开的宽字符变为空白
+func (r *Row) fixWide() {
+	for i := 0; i < len(r.cells); {
+		width := r.cells[i].Width
+		if width == 0 {
+			r.cells[i] = blankCell(r.cells[i].Attr)
+			i++
+			continue
+		}
+		for j := i + 1; j < i+width; j++ {
+			if j == len(r.cells) || r.cells[j].Width != 0 {
+				r.cells[i] = blankCell(r.cells[i].Attr)
+				width = 1
+				break
+			}
+		}
+		i += width
 	}
 }
 
-// 删除当前光标所在位置左侧的字符
-func (r *Row) eraseLeft() {
-	r.data = r.data[r.index:]
+// 清除当前光标所在位置右侧的字符（包含光标所在字符）
+func (r *Row) eraseRight(col int, attr Attr) {
+	r.erase(col, len(r.cells), attr)
+}
+
+// 清除当前光标所在位置左侧的字符（包含光标所在字符），其余字符位置不变
+func (r *Row) eraseLeft(col int, attr Attr) {
+	r.erase(0, col+1, attr)
+}
+
+// Len 返回该行的列数
+func (r *Row) Len() int {
+	return len(r.cells)
+}
+
+// Cell 返回指定列的字符单元，超出范围时返回空白单元
+func (r *Row) Cell(col int) Cell {
+	if col < 0 || col >= len(r.cells) {
+		return blankCell(Attr{})
+	}
+	return r.cells[col]
+}
+
+// Cells 返回该行所有字符单元的副本
+func (r *Row) Cells() []Cell {
+	cells := make([]Cell, len(r.cells))
+	copy(cells, r.cells)
+	return cells
+}
+
+// Wrapped 返回该行是否因自动换行而延续到下一行
+func (r *Row) Wrapped() bool {
+	return r.wrapped
+}
+
+func (r *Row) clone() *Row {
+	return &Row{cells: r.Cells(), wrapped: r.wrapped, skipped: r.skipped}
+}
+
+// 与下一行拼接时使用的列数，宽字符提前换行时跳过的空白列不属于文本
+func (r *Row) wrapEnd() int {
+	n := len(r.cells)
+	if r.skipped && n > 0 && r.cells[n-1].IsBlank() {
+		return n - 1
+	}
+	return n
+}
+
+// 取消自动换行的标记
+func (r *Row) unwrap() {
+	r.wrapped = false
+	r.skipped = false
+}
+
+func cloneRows(rows []*Row) []*Row {
+	result := make([]*Row, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.clone())
+	}
+	return result
+}
+
+func (r *Row) isEmpty() bool {
+	return r.String() == ""
+}
+
+// 该行的完整文本，不去除行尾空格
+func (r *Row) text() string {
+	return r.slice(0, len(r.cells))
+}
+
+// [from, to) 范围内的文本，占位单元没有文本
+func (r *Row) slice(from, to int) string {
+	from = max(from, 0)
+	to = min(to, len(r.cells))
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		b.WriteString(r.cells[i].Text)
+	}
+	return b.String()
 }
 
+// String 返回该行的纯文本，去除行尾空格
 func (r *Row) String() string {
-	return string(r.data)
+	return strings.TrimRight(r.text(), string(space))
 }
@@ -1,28 +1,7 @@
 package vt
 
-// insert 向指定位置插入元素
-func insert(data []rune, index int, val rune) []rune {
-	if len(data) < index {
-		return data
-	}
-	data = append(data, 0)
-	copy(data[index+1:], data[index:])
-	data[index] = val
-	return data
-}
-
-// remove 从某个位置开始删除n个元素
-func remove(data []rune, index, num int) (result []rune) {
-	if index < len(data) {
-		result = append(result, data[0:index]...)
-	}
-	if index+num < len(data) {
-		result = append(result, data[index+num:]...)
-	}
-	return result
-}
-
-/** C0 控制字符
+/*
+* C0 控制字符
 00000000	0	00	NUL (NULL)	空字符
 00000001	1	01	SOH (Start Of Headling)	标题开始
 00000010	2	02	STX (Start Of Text)	正文开始
@@ -61,7 +40,8 @@ func isC0Sequence(code rune) bool {
 	return (code >= 0 && code <= 31) || code == 127
 }
 
-/** CSI 序列
+/*
+* CSI 序列
 
 组成部分	字符范围	ASCII
 参数字节	0x30–0x3F	0–9:;<=>?
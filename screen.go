@@ -0,0 +1,99 @@
+package vt
+
+// 保存的光标状态，用于 DECSC/DECRC、CSI s/u 以及 ?1049 切换屏幕时恢复光标
+type cursorState struct {
+	x, y        int
+	attr        Attr
+	wrapPending bool
+	origin      bool    // 原点模式（DECOM）
+	charsets    [4]rune // G0-G3 字符集
+	gl          int     // 映射到 GL 的字符集
+	protected   bool    // 字符保护属性（DECSCA）
+}
+
+// ESC 7  Save Cursor (DECSC).
+func (vt *virtualTerminal) saveCursor() {
+	*vt.savedCursorSlot() = cursorState{
+		x:           vt.x,
+		y:           vt.y,
+		attr:        vt.attr,
+		wrapPending: vt.wrapPending,
+		origin:      vt.mode(ModeOrigin),
+		charsets:    vt.charsets,
+		gl:          vt.gl,
+		protected:   vt.protected,
+	}
+}
+
+// ESC 8  Restore Cursor (DECRC)，没有保存过时光标回到左上角并重置显示属性和字符集
+func (vt *virtualTerminal) restoreCursor() {
+	saved := vt.savedCursorSlot()
+	if saved.charsets == [4]rune{} {
+		vt.resetCharsets()
+	} else {
+		vt.charsets = saved.charsets
+		vt.gl = saved.gl
+	}
+	vt.modes[ModeOrigin] = saved.origin
+	vt.moveTo(saved.x, saved.y)
+	vt.attr = saved.attr
+	vt.protected = saved.protected
+	vt.wrapPending = saved.wrapPending
+}
+
+// 与 xterm 一致，主屏幕和备用屏幕各自保存光标
+func (vt *virtualTerminal) savedCursorSlot() *cursorState {
+	if vt.altActive {
+		return &vt.altSavedCursor
+	}
+	return &vt.mainSavedCursor
+}
+
+// 切换到备用屏幕，clear 为 true 时清除备用屏幕的内容
+func (vt *virtualTerminal) useAlternateScreen(clear bool) {
+	if vt.altActive {
+		return
+	}
+	vt.altActive = true
+	vt.screen = vt.altScreen
+	if clear {
+		vt.clearScreen()
+	}
+}
+
+// 切换回主屏幕，clear 为 true 时先清除备用屏幕的内容
+func (vt *virtualTerminal) useMainScreen(clear bool) {
+	if !vt.altActive {
+		return
+	}
+	vt.captureFrame()
+	if clear {
+		vt.clearScreen()
+	}
+	vt.altActive = false
+	vt.screen = vt.mainScreen
+}
+
+// 开启 CaptureAlternateScreen 时，在备用屏幕被清除或切换回主屏幕之前保存一帧
+func (vt *virtualTerminal) captureFrame() {
+	if !vt.captureAlternate || !vt.altActive || usedRows(vt.screen) == 0 {
+		return
+	}
+	vt.frames = append(vt.frames, cloneRows(vt.screen))
+}
+
+// 清除当前屏幕的所有行
+func (vt *virtualTerminal) clearScreen() {
+	for i := range vt.screen {
+		vt.screen[i] = vt.newRow()
+	}
+}
+
+// 屏幕中已使用的行数，忽略屏幕底部的空行
+func usedRows(screen []*Row) int {
+	n := len(screen)
+	for n > 0 && screen[n-1].isEmpty() {
+		n--
+	}
+	return n
+}
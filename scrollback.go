@@ -0,0 +1,48 @@
+package vt
+
+// scrollback 保存滚出屏幕顶部的行，是一个固定容量的环形缓冲区，写满后丢弃最早的行
+type scrollback struct {
+	rows  []*Row
+	start int // 最早一行所在的下标
+	limit int // 最多保存的行数
+	total int // 累计进入 scrollback 的行数，包括已被丢弃和清除的行，用于计算行号
+}
+
+func newScrollback(limit int) *scrollback {
+	return &scrollback{limit: limit}
+}
+
+func (s *scrollback) push(rows ...*Row) {
+	s.total += len(rows)
+	for _, row := range rows {
+		if len(s.rows) < s.limit {
+			s.rows = append(s.rows, row)
+			continue
+		}
+		s.rows[s.start] = row
+		s.start = (s.start + 1) % s.limit
+	}
+}
+
+func (s *scrollback) len() int {
+	return len(s.rows)
+}
+
+// 获取第i行，0为最早的一行
+func (s *scrollback) get(i int) *Row {
+	return s.rows[(s.start+i)%len(s.rows)]
+}
+
+func (s *scrollback) list() []*Row {
+	result := make([]*Row, 0, s.len())
+	for i := 0; i < s.len(); i++ {
+		result = append(result, s.get(i))
+	}
+	return result
+}
+
+// 清除保存的行，不影响 total，已有的行号仍然有效
+func (s *scrollback) clear() {
+	s.rows = nil
+	s.start = 0
+}
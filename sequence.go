@@ -0,0 +1,110 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	paramMissing  = -1    // 缺失的参数，例如 CSI ;5H 中的第一个参数
+	maxParamValue = 65535 // 参数的最大值，与 xterm 一致
+)
+
+// csiSequence 解析后的 CSI 序列。
+// 参数以分号分隔，每个参数可以包含以冒号分隔的子参数，例如 CSI 38:2::255:0:0 m
+type csiSequence struct {
+	prefix        rune    // 私有前缀 < = > ?，没有时为0
+	params        [][]int // 每个参数及其子参数，params[i][0] 为参数本身
+	intermediates string  // 中间字符，例如 CSI ? Ps $ p 中的 $
+	final         rune    // 最终字符
+}
+
+func parseCSISequence(params, intermediates []rune, final rune) *csiSequence {
+	seq := &csiSequence{
+		intermediates: string(intermediates),
+		final:         final,
+	}
+	if len(params) > 0 && isPrivateMarker(params[0]) {
+		seq.prefix = params[0]
+		params = params[1:]
+	}
+	if len(params) == 0 {
+		return seq
+	}
+	for _, field := range strings.Split(string(params), string(_SEMICOLON)) {
+		var param []int
+		for _, sub := range strings.Split(field, ":") {
+			param = append(param, parseParam(sub))
+		}
+		seq.params = append(seq.params, param)
+	}
+	return seq
+}
+
+func parseParam(s string) int {
+	if s == "" {
+		return paramMissing
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n > maxParamValue {
+		return maxParamValue
+	}
+	return n
+}
+
+// 处理器在表中的键，由私有前缀、中间字符和最终字符组成，例如 ?h、$p、?$p
+func (seq *csiSequence) id() string {
+	var b strings.Builder
+	if seq.prefix != 0 {
+		b.WriteRune(seq.prefix)
+	}
+	b.WriteString(seq.intermediates)
+	b.WriteRune(seq.final)
+	return b.String()
+}
+
+// 获取第 index 个参数，参数缺失时返回默认值
+func (seq *csiSequence) getNumberOrDefault(index, _default int) int {
+	// 下标检查
+	if len(seq.params)-1 < index {
+		return _default
+	}
+	n := seq.params[index][0]
+	if n == paramMissing {
+		return _default
+	}
+	return n
+}
+
+// 获取所有参数，缺失的参数使用默认值，没有参数时返回空
+func (seq *csiSequence) getNumbers(_default int) []int {
+	result := make([]int, len(seq.params))
+	for i := range result {
+		result[i] = seq.getNumberOrDefault(i, _default)
+	}
+	return result
+}
+
+func (seq *csiSequence) String() string {
+	var b strings.Builder
+	b.WriteString("CSI ")
+	if seq.prefix != 0 {
+		b.WriteRune(seq.prefix)
+	}
+	for i, param := range seq.params {
+		if i > 0 {
+			b.WriteRune(_SEMICOLON)
+		}
+		for j, n := range param {
+			if j > 0 {
+				b.WriteByte(':')
+			}
+			if n != paramMissing {
+				b.WriteString(strconv.Itoa(n))
+			}
+		}
+	}
+	b.WriteString(seq.intermediates)
+	b.WriteRune(seq.final)
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package vt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Session shell 通过 OSC 7 和 iTerm2 的 OSC 1337 上报的会话信息
+type Session struct {
+	User       string            // RemoteHost 上报的用户名
+	Host       string            // RemoteHost 或 OSC 7 上报的主机名
+	CurrentDir string            // CurrentDir 或 OSC 7 上报的当前目录
+	UserVars   map[string]string // SetUserVar 设置的变量，值已经过 base64 解码
+
+	ShellIntegrationVersion string // shell integration 脚本的版本
+	Shell                   string // shell integration 脚本上报的 shell 名称，例如 bash、zsh
+
+	// SetMark 标记的行号。行号从终端输出的第一行开始计数，包括已从 scrollback 中丢弃的行，
+	// 每一行对应屏幕上的一行，自动换行的行不会被合并，可以使用 VirtualTerminal.Line 获取
+	Marks []int
+}
+
+func (s Session) clone() Session {
+	s.UserVars = maps.Clone(s.UserVars)
+	s.Marks = slices.Clone(s.Marks)
+	return s
+}
+
+// 光标所在行的行号，从终端输出的第一行开始计数
+func (vt *virtualTerminal) lineNumber() int {
+	return vt.scrollback.total + vt.y
+}
+
+// 指定行号的行，已从 scrollback 中丢弃的行返回 nil。备用屏幕上的内容不计入行号
+func (vt *virtualTerminal) line(n int) *Row {
+	i := n - (vt.scrollback.total - vt.scrollback.len())
+	switch {
+	case i < 0:
+		return nil
+	case i < vt.scrollback.len():
+		return vt.scrollback.get(i)
+	case i-vt.scrollback.len() < vt.rows:
+		return vt.mainScreen[i-vt.scrollback.len()]
+	}
+	return nil
+}
+
+// OSC 7 ; file://host/path  由 bash/zsh（vte.sh）和 fish 等 shell 上报当前目录，路径经过 URL 编码。
+// 很多 shell 只编码空格，路径中的 # 和 ? 不能按 URL 解析，解码失败时使用原始路径
+func (vt *virtualTerminal) setWorkingDirectory(pt string) {
+	rest, ok := strings.CutPrefix(pt, "file://")
+	i := strings.IndexByte(rest, '/')
+	if !ok || i < 0 {
+		vt.log(fmt.Sprintf("invalid working directory %q", pt))
+		return
+	}
+	path := rest[i:]
+	if decoded, err := url.PathUnescape(path); err == nil {
+		path = decoded
+	}
+	vt.session.Host = rest[:i]
+	vt.session.CurrentDir = path
+}
+
+/**
+ * OSC 1337 ; key=value  iTerm2 的私有序列，value 中可能包含 =
+ *
+ * | Key                     | Value                                    |
+ * | ----------------------- | ---------------------------------------- |
+ * | RemoteHost              | user@host                                |
+ * | CurrentDir              | 当前目录                                 |
+ * | SetUserVar              | name=base64编码的值                      |
+ * | SetMark                 | 无，标记光标所在行                       |
+ * | ShellIntegrationVersion | 版本号，可以带有 ;shell=名称             |
+ */
+func (vt *virtualTerminal) handleITermSequence(pt string) {
+	key, value, _ := strings.Cut(pt, "=")
+	switch key {
+	case "RemoteHost":
+		user, host, ok := strings.Cut(value, "@")
+		if !ok {
+			user, host = "", value
+		}
+		vt.session.User = user
+		vt.session.Host = host
+	case "CurrentDir":
+		vt.session.CurrentDir = value
+	case "SetUserVar":
+		vt.setUserVar(value)
+	case "SetMark":
+		vt.session.Marks = append(vt.session.Marks, vt.lineNumber())
+		// 没有使用 OSC 133 时，将标记作为提示符的开始
+		if !vt.shellIntegration {
+			vt.promptStart()
+		}
+	case "ShellIntegrationVersion":
+		version, args, _ := strings.Cut(value, string(_SEMICOLON))
+		vt.session.ShellIntegrationVersion = version
+		for _, arg := range strings.Split(args, string(_SEMICOLON)) {
+			if shell, ok := strings.CutPrefix(arg, "shell="); ok {
+				vt.session.Shell = shell
+			}
+		}
+	default:
+		vt.log(fmt.Sprintf("unsupported iterm2 sequence %q", key))
+	}
+}
+
+// SetUserVar=name=base64，值不是合法的 base64 时忽略
+func (vt *virtualTerminal) setUserVar(value string) {
+	name, encoded, ok := strings.Cut(value, "=")
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if !ok || name == "" || err != nil {
+		vt.log(fmt.Sprintf("invalid user var %q", value))
+		return
+	}
+	if vt.session.UserVars == nil {
+		vt.session.UserVars = make(map[string]string)
+	}
+	vt.session.UserVars[name] = string(decoded)
+}
@@ -0,0 +1,245 @@
+package vt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColorType 颜色类型
+type ColorType uint8
+
+const (
+	ColorDefault ColorType = iota // 终端默认颜色
+	ColorIndexed                  // 调色板颜色，0-7为标准色，8-15为高亮色，16-255为扩展色
+	ColorRGB                      // 24位真彩色
+)
+
+// Color 前景色或背景色
+type Color struct {
+	Type    ColorType
+	Index   uint8 // Type 为 ColorIndexed 时有效
+	R, G, B uint8 // Type 为 ColorRGB 时有效
+}
+
+// IndexedColor 返回调色板中的颜色
+func IndexedColor(index uint8) Color {
+	return Color{Type: ColorIndexed, Index: index}
+}
+
+// RGBColor 返回24位真彩色
+func RGBColor(r, g, b uint8) Color {
+	return Color{Type: ColorRGB, R: r, G: g, B: b}
+}
+
+// UnderlineStyle 下划线样式
+type UnderlineStyle uint8
+
+const (
+	UnderlineNone UnderlineStyle = iota
+	UnderlineSingle
+	UnderlineDouble
+	UnderlineCurly
+	UnderlineDotted
+	UnderlineDashed
+)
+
+// Attr 字符的显示属性，由 SGR（CSI Pm m）设置
+type Attr struct {
+	Bold          bool
+	Dim           bool
+	Italic        bool
+	Underline     UnderlineStyle
+	Blink         bool
+	Inverse       bool
+	Hidden        bool
+	Strikethrough bool
+	Fg            Color // 前景色
+	Bg            Color // 背景色
+}
+
+/**
+ * CSI Pm m  Character Attributes (SGR).
+ *
+ * | Param     | Action                                   |
+ * | --------- | ---------------------------------------- |
+ * | 0         | 重置所有属性                             |
+ * | 1         | 粗体                                     |
+ * | 2         | 暗淡                                     |
+ * | 3         | 斜体                                     |
+ * | 4         | 下划线，4:Ps 指定下划线样式              |
+ * | 5, 6      | 闪烁                                     |
+ * | 7         | 反显                                     |
+ * | 8         | 隐藏                                     |
+ * | 9         | 删除线                                   |
+ * | 21        | 双下划线                                 |
+ * | 22        | 取消粗体和暗淡                           |
+ * | 23        | 取消斜体                                 |
+ * | 24        | 取消下划线                               |
+ * | 25        | 取消闪烁                                 |
+ * | 27        | 取消反显                                 |
+ * | 28        | 取消隐藏                                 |
+ * | 29        | 取消删除线                               |
+ * | 30 - 37   | 前景色                                   |
+ * | 38        | 扩展前景色，38;5;Ps 或 38;2;Pr;Pg;Pb     |
+ * |           | 也可以使用冒号分隔，例如 38:2::Pr:Pg:Pb  |
+ * | 39        | 默认前景色                               |
+ * | 40 - 47   | 背景色                                   |
+ * | 48        | 扩展背景色，48;5;Ps 或 48;2;Pr;Pg;Pb     |
+ * | 49        | 默认背景色                               |
+ * | 58        | 下划线颜色，参数与 38 相同，目前被忽略   |
+ * | 59        | 默认下划线颜色，目前被忽略               |
+ * | 90 - 97   | 高亮前景色                               |
+ * | 100 - 107 | 高亮背景色                               |
+ */
+func (a *Attr) apply(params [][]int) {
+	if len(params) == 0 {
+		params = [][]int{{0}}
+	}
+	for i := 0; i < len(params); i++ {
+		ps := max(params[i][0], 0)
+		sub := params[i][1:]
+		switch {
+		case ps == 0:
+			*a = Attr{}
+		case ps == 1:
+			a.Bold = true
+		case ps == 2:
+			a.Dim = true
+		case ps == 3:
+			a.Italic = true
+		case ps == 4:
+			// 4:Ps 指定下划线样式，例如 4:3 为波浪线
+			a.Underline = UnderlineSingle
+			if len(sub) > 0 && sub[0] >= 0 && sub[0] <= int(UnderlineDashed) {
+				a.Underline = UnderlineStyle(sub[0])
+			}
+		case ps == 5, ps == 6:
+			a.Blink = true
+		case ps == 7:
+			a.Inverse = true
+		case ps == 8:
+			a.Hidden = true
+		case ps == 9:
+			a.Strikethrough = true
+		case ps == 21:
+			a.Underline = UnderlineDouble
+		case ps == 22:
+			a.Bold = false
+			a.Dim = false
+		case ps == 23:
+			a.Italic = false
+		case ps == 24:
+			a.Underline = UnderlineNone
+		case ps == 25:
+			a.Blink = false
+		case ps == 27:
+			a.Inverse = false
+		case ps == 28:
+			a.Hidden = false
+		case ps == 29:
+			a.Strikethrough = false
+		case ps >= 30 && ps <= 37:
+			a.Fg = IndexedColor(uint8(ps - 30))
+		case ps == 38:
+			color, n := extendedColor(params[i+1:], sub)
+			a.Fg = color
+			i += n
+		case ps == 39:
+			a.Fg = Color{}
+		case ps >= 40 && ps <= 47:
+			a.Bg = IndexedColor(uint8(ps - 40))
+		case ps == 48:
+			color, n := extendedColor(params[i+1:], sub)
+			a.Bg = color
+			i += n
+		case ps == 49:
+			a.Bg = Color{}
+		case ps == 58:
+			// 不保存下划线颜色，但需要跳过颜色参数，避免被当作其他属性
+			_, n := extendedColor(params[i+1:], sub)
+			i += n
+		case ps >= 90 && ps <= 97:
+			a.Fg = IndexedColor(uint8(ps - 90 + 8))
+		case ps >= 100 && ps <= 107:
+			a.Bg = IndexedColor(uint8(ps - 100 + 8))
+		}
+	}
+}
+
+// 解析 38 和 48 之后的扩展颜色参数，返回颜色和额外使用的参数个数。
+// 支持以冒号分隔的子参数 38:5:Ps、38:2:Pi:Pr:Pg:Pb（Pi 为可省略的颜色空间）和 38:2:Pr:Pg:Pb，
+// 以及以分号分隔的 38;5;Ps、38;2;Pr;Pg;Pb，参数不完整时返回默认颜色
+func extendedColor(params [][]int, sub []int) (Color, int) {
+	if len(sub) > 0 {
+		if sub[0] == 2 && len(sub) >= 5 {
+			// 跳过颜色空间
+			sub = append([]int{2}, sub[2:]...)
+		}
+		color, _ := colorOf(sub)
+		return color, 0
+	}
+	values := make([]int, 0, len(params))
+	for _, param := range params {
+		values = append(values, param[0])
+	}
+	return colorOf(values)
+}
+
+func colorOf(values []int) (Color, int) {
+	if len(values) == 0 {
+		return Color{}, 0
+	}
+	switch values[0] {
+	case 5:
+		if len(values) < 2 {
+			return Color{}, len(values)
+		}
+		return IndexedColor(colorValue(values[1])), 2
+	case 2:
+		if len(values) < 4 {
+			return Color{}, len(values)
+		}
+		return RGBColor(colorValue(values[1]), colorValue(values[2]), colorValue(values[3])), 4
+	}
+	return Color{}, 1
+}
+
+func colorValue(n int) uint8 {
+	return uint8(clamp(n, 0, 255))
+}
+
+// 以 SGR 参数的形式表示显示属性，例如 0;1;38;5;196，用于 DECRQSS 的应答
+func (a Attr) sgr() string {
+	params := []string{"0"}
+	add := func(ok bool, ps string) {
+		if ok {
+			params = append(params, ps)
+		}
+	}
+	add(a.Bold, "1")
+	add(a.Dim, "2")
+	add(a.Italic, "3")
+	add(a.Underline == UnderlineSingle, "4")
+	add(a.Underline > UnderlineSingle, "4:"+strconv.Itoa(int(a.Underline)))
+	add(a.Blink, "5")
+	add(a.Inverse, "7")
+	add(a.Hidden, "8")
+	add(a.Strikethrough, "9")
+	add(a.Fg.Type != ColorDefault, a.Fg.sgr(30, 90, 38))
+	add(a.Bg.Type != ColorDefault, a.Bg.sgr(40, 100, 48))
+	return strings.Join(params, ";")
+}
+
+// 颜色对应的 SGR 参数，base 为标准色，bright 为高亮色，extended 为扩展颜色
+func (c Color) sgr(base, bright, extended int) string {
+	switch {
+	case c.Type == ColorRGB:
+		return fmt.Sprintf("%d;2;%d;%d;%d", extended, c.R, c.G, c.B)
+	case c.Index < 8:
+		return strconv.Itoa(base + int(c.Index))
+	case c.Index < 16:
+		return strconv.Itoa(bright + int(c.Index) - 8)
+	}
+	return fmt.Sprintf("%d;5;%d", extended, c.Index)
+}
@@ -1,50 +1,153 @@
 package vt
 
+// 光标移动到左上角，原点模式下为滚动区域的左上角
 func (vt *virtualTerminal) resetCursor() {
-	vt.getCurrentRow().setIndex(0)
-	vt.rows = 0
+	vt.moveToOrigin(0, 0)
 }
 
+// 移动光标到相对于原点的位置，原点模式（DECOM）下行号相对于滚动区域且不会移出滚动区域
+func (vt *virtualTerminal) moveToOrigin(col, row int) {
+	if vt.mode(ModeOrigin) {
+		vt.setCol(col)
+		vt.y = clamp(row+vt.top, vt.top, vt.bottom)
+		return
+	}
+	vt.moveTo(col, row)
+}
+
+// 移动光标到指定位置，超出屏幕边缘时停在边缘
 func (vt *virtualTerminal) moveTo(col, row int) {
 	vt.setCol(col)
 	vt.setRow(row)
 }
 
 func (vt *virtualTerminal) setRow(row int) {
-	vt.rows = row
+	vt.wrapPending = false
+	vt.y = clamp(row, 0, vt.rows-1)
 }
 
 func (vt *virtualTerminal) setCol(col int) {
-	vt.getCurrentRow().setIndex(col)
+	vt.wrapPending = false
+	vt.x = clamp(col, 0, vt.cols-1)
 }
 
+// 光标位于滚动区域内时，向上移动不会超过滚动区域的第一行
 func (vt *virtualTerminal) moveUp(ps int) {
-	vt.rows -= ps
-	if vt.rows < 0 {
-		vt.rows = 0
+	if vt.y >= vt.top {
+		vt.y = max(vt.y-ps, vt.top)
+		vt.wrapPending = false
+		return
 	}
+	vt.setRow(vt.y - ps)
 }
 
+// 光标位于滚动区域内时，向下移动不会超过滚动区域的最后一行
 func (vt *virtualTerminal) moveDown(ps int) {
-	vt.rows += ps
+	if vt.y <= vt.bottom {
+		vt.y = min(vt.y+ps, vt.bottom)
+		vt.wrapPending = false
+		return
+	}
+	vt.setRow(vt.y + ps)
 }
 
 func (vt *virtualTerminal) moveBackward(ps int) {
-	index := vt.getCurrentRow().index
-	index -= ps
-	if index < 0 {
-		index = 0
-	}
-	vt.setCol(index)
+	vt.setCol(vt.x - ps)
 }
 
 func (vt *virtualTerminal) moveForward(ps int) {
-	index := vt.getCurrentRow().index + ps
-	vt.setCol(index)
+	vt.setCol(vt.x + ps)
 }
 
 func (vt *virtualTerminal) move(col int, row int) {
-	newCol := vt.getCurrentRow().index + col
-	newRow := vt.rows + row
-	vt.moveTo(newCol, newRow)
+	vt.moveTo(vt.x+col, vt.y+row)
+}
+
+func (vt *virtualTerminal) resetScrollRegion() {
+	vt.top = 0
+	vt.bottom = vt.rows - 1
+}
+
+// 换行，光标位于滚动区域最后一行时滚动区域内的内容向上滚动一行
+func (vt *virtualTerminal) lineFeed() {
+	vt.wrapPending = false
+	if vt.y == vt.bottom {
+		vt.scrollUp(1)
+		return
+	}
+	vt.setRow(vt.y + 1)
+}
+
+// 反向换行，光标位于滚动区域第一行时滚动区域内的内容向下滚动一行
+func (vt *virtualTerminal) reverseIndex() {
+	vt.wrapPending = false
+	if vt.y == vt.top {
+		vt.scrollDown(1)
+		return
+	}
+	vt.setRow(vt.y - 1)
+}
+
+// 滚动区域内的内容向上滚动n行，底部补充空行。
+// 在主屏幕上滚动区域从第一行开始时，滚出顶部的行进入 scrollback
+func (vt *virtualTerminal) scrollUp(n int) {
+	region := vt.screen[vt.top : vt.bottom+1]
+	n = min(n, len(region))
+	if vt.top == 0 && !vt.altActive {
+		vt.scrollback.push(region[:n]...)
+	}
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = vt.blankRow()
+	}
+}
+
+// 滚动区域内的内容向下滚动n行，顶部补充空行，滚出底部的行被丢弃
+func (vt *virtualTerminal) scrollDown(n int) {
+	region := vt.screen[vt.top : vt.bottom+1]
+	n = min(n, len(region))
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = vt.blankRow()
+	}
+}
+
+// 在光标所在行插入n个空行，光标到滚动区域底部之间的行向下移动，滚出底部的行被丢弃。
+// 光标不在滚动区域内时无效
+func (vt *virtualTerminal) insertLines(n int) {
+	if vt.y < vt.top || vt.y > vt.bottom {
+		return
+	}
+	region := vt.screen[vt.y : vt.bottom+1]
+	n = min(n, len(region))
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = vt.blankRow()
+	}
+	vt.setCol(0)
+}
+
+// 从光标所在行开始删除n行，下方的行向上移动，滚动区域底部补充空行。
+// 光标不在滚动区域内时无效
+func (vt *virtualTerminal) deleteLines(n int) {
+	if vt.y < vt.top || vt.y > vt.bottom {
+		return
+	}
+	region := vt.screen[vt.y : vt.bottom+1]
+	n = min(n, len(region))
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = vt.blankRow()
+	}
+	vt.setCol(0)
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
 }
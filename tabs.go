@@ -0,0 +1,66 @@
+package vt
+
+const tabWidth = 8 // 默认每8列一个制表位
+
+// 初始化制表位，默认每8列一个
+func (vt *virtualTerminal) resetTabStops() {
+	vt.tabStops = make([]bool, vt.cols)
+	for i := tabWidth; i < vt.cols; i += tabWidth {
+		vt.tabStops[i] = true
+	}
+}
+
+// 光标向右移动到第n个制表位，没有更多制表位时停在最后一列
+func (vt *virtualTerminal) tabForward(n int) {
+	col := vt.x
+	for ; n > 0 && col < vt.cols-1; n-- {
+		col++
+		for col < vt.cols-1 && !vt.tabStops[col] {
+			col++
+		}
+	}
+	vt.setCol(col)
+}
+
+// 光标向左移动到第n个制表位，没有更多制表位时停在第一列
+func (vt *virtualTerminal) tabBackward(n int) {
+	col := vt.x
+	for ; n > 0 && col > 0; n-- {
+		col--
+		for col > 0 && !vt.tabStops[col] {
+			col--
+		}
+	}
+	vt.setCol(col)
+}
+
+// ESC H  Horizontal Tab Set (HTS)，在光标所在列设置制表位
+func (vt *virtualTerminal) setTabStop() {
+	vt.tabStops[vt.x] = true
+}
+
+// CSI Ps g  Tab Clear (TBC).
+//
+//	Ps = 0  -> 清除光标所在列的制表位（默认）
+//	Ps = 3  -> 清除所有制表位
+func (vt *virtualTerminal) tabClear(seq *csiSequence) error {
+	switch seq.getNumberOrDefault(0, 0) {
+	case 0:
+		vt.tabStops[vt.x] = false
+	case 3:
+		vt.tabStops = make([]bool, vt.cols)
+	}
+	return nil
+}
+
+// CSI Ps I  Cursor Forward Tabulation Ps tab stops (default = 1) (CHT).
+func (vt *virtualTerminal) cursorForwardTab(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.tabForward)
+	return nil
+}
+
+// CSI Ps Z  Cursor Backward Tabulation Ps tab stops (default = 1) (CBT).
+func (vt *virtualTerminal) cursorBackwardTab(seq *csiSequence) error {
+	vt.cursorChange(seq, vt.tabBackward)
+	return nil
+}
@@ -0,0 +1,86 @@
+package vt
+
+const maxTitleStack = 10 // 标题栈的最大深度，与 xterm 一致
+
+// TitleChange 窗口标题的一次变化
+type TitleChange struct {
+	Title  string
+	Offset int64 // 设置标题的控制序列在输入中的字节偏移，从 ESC 开始计算
+}
+
+// 窗口标题和图标名称，在标题栈中时 hasTitle 和 hasIconName 表示保存了哪些部分
+type titleState struct {
+	title       string
+	iconName    string
+	hasTitle    bool
+	hasIconName bool
+}
+
+// OSC 0 和 OSC 2 设置窗口标题，标题与当前不同时记录到历史中
+func (vt *virtualTerminal) setTitle(title string) {
+	if title == vt.title.title {
+		return
+	}
+	vt.title.title = title
+	vt.titleHistory = append(vt.titleHistory, TitleChange{Title: title, Offset: vt.parser.start})
+}
+
+// OSC 0 和 OSC 1 设置图标名称
+func (vt *virtualTerminal) setIconName(iconName string) {
+	vt.title.iconName = iconName
+}
+
+/**
+ * CSI Ps ; Ps ; Ps t  Window manipulation (XTWINOPS)，只支持标题栈
+ *     Ps = 2 2 ; 0  -> Save xterm icon and window title on stack.
+ *     Ps = 2 2 ; 1  -> Save xterm icon title on stack.
+ *     Ps = 2 2 ; 2  -> Save xterm window title on stack.
+ *     Ps = 2 3 ; 0  -> Restore xterm icon and window title from stack.
+ *     Ps = 2 3 ; 1  -> Restore xterm icon title from stack.
+ *     Ps = 2 3 ; 2  -> Restore xterm window title from stack.
+ */
+func (vt *virtualTerminal) windowManipulation(seq *csiSequence) error {
+	ps := seq.getNumberOrDefault(1, 0)
+	switch seq.getNumberOrDefault(0, 0) {
+	case 22:
+		vt.pushTitle(ps)
+	case 23:
+		vt.popTitle(ps)
+	}
+	return nil
+}
+
+// 将当前的标题压入栈中，超出最大深度时丢弃最早的一项
+func (vt *virtualTerminal) pushTitle(ps int) {
+	if ps < 0 || ps > 2 {
+		return
+	}
+	var saved titleState
+	if ps == 0 || ps == 1 {
+		saved.iconName = vt.title.iconName
+		saved.hasIconName = true
+	}
+	if ps == 0 || ps == 2 {
+		saved.title = vt.title.title
+		saved.hasTitle = true
+	}
+	if len(vt.titleStack) == maxTitleStack {
+		vt.titleStack = vt.titleStack[1:]
+	}
+	vt.titleStack = append(vt.titleStack, saved)
+}
+
+// 从栈中弹出标题，ps 指定恢复窗口标题、图标名称或两者，只恢复压入时保存的部分
+func (vt *virtualTerminal) popTitle(ps int) {
+	if ps < 0 || ps > 2 || len(vt.titleStack) == 0 {
+		return
+	}
+	saved := vt.titleStack[len(vt.titleStack)-1]
+	vt.titleStack = vt.titleStack[:len(vt.titleStack)-1]
+	if (ps == 0 || ps == 1) && saved.hasIconName {
+		vt.setIconName(saved.iconName)
+	}
+	if (ps == 0 || ps == 2) && saved.hasTitle {
+		vt.setTitle(saved.title)
+	}
+}
@@ -1,12 +1,11 @@
 package vt
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"log"
-	"strconv"
+	"slices"
 	"strings"
-	"unicode/utf8"
 )
 
 const (
@@ -15,6 +14,7 @@ const (
 	_HT  rune = 0x09 // Position to the next character tab stop.(Caret = ^I, C = \t)
 	_LF  rune = 0x0a // LF Line Feed (Caret = ^J, C = \n)
 	_VT  rune = 0x0b // Position the form at the next line tab stop.(Caret = ^K, C = \v)
+	_FF  rune = 0x0c // Form Feed (Caret = ^L, C = \f)
 	_CR  rune = 0x0d // Carriage Return (Caret = ^M, C = \r)
 
 	_ESC rune = 0x1b // Escape (Caret = ^[, C = \e)
@@ -27,129 +27,220 @@ const (
 	space rune = 0x20 // 空格
 )
 
-type inputHandler func(params []rune) error
+type inputHandler func(seq *csiSequence) error
 
 type VirtualTerminal interface {
 	Advance(p []byte)
 	Output() []string
+	// HTML 将 Output 中的内容渲染为 HTML，保留颜色、样式和超链接
+	HTML() string
 	Reset()
+	// CurrentDir 返回 shell 通过 OSC 7 或 OSC 1337 CurrentDir 上报的当前目录
 	CurrentDir() string
+	// CurrentHost 返回 shell 通过 OSC 7 或 OSC 1337 RemoteHost 上报的主机名
+	CurrentHost() string
+	// Session 返回 shell 通过 OSC 7 和 OSC 1337 上报的会话信息
+	Session() Session
+	// Title 返回 OSC 0 或 OSC 2 设置的窗口标题
+	Title() string
+	// IconName 返回 OSC 0 或 OSC 1 设置的图标名称
+	IconName() string
+	// TitleHistory 返回窗口标题的变化历史，最早的在前
+	TitleHistory() []TitleChange
+	// Commands 返回 shell integration（OSC 133）划分出的命令，最早的在前。
+	// 提示符、命令和输出从屏幕和 scrollback 中读取，已从 scrollback 中丢弃的行为空
+	Commands() []CommandBlock
+	// Screen 返回当前屏幕上的所有行
+	Screen() []*Row
+	// Scrollback 返回已滚出屏幕顶部的行，最早的行在前
+	Scrollback() []*Row
+	// Line 返回指定行号的行，行号与 Session.Marks 相同。已从 scrollback 中丢弃或超出屏幕的行返回 nil
+	Line(n int) *Row
+	// AlternateScreen 返回当前是否正在使用备用屏幕，例如正在运行 vim、top 等全屏程序
+	AlternateScreen() bool
+	// AlternateFrames 返回开启 CaptureAlternateScreen 后保存的备用屏幕画面
+	AlternateFrames() [][]*Row
+	// Mode 返回 DEC 私有模式的状态
+	Mode(mode Mode) bool
 }
 
+const (
+	defaultCols = 80 // 默认列数
+	defaultRows = 24 // 默认行数
+
+	defaultScrollback = 10000 // 默认最多保存的历史行数
+)
+
 type Opts struct {
-	Logger *log.Logger
+	Cols       int // 列数，小于等于0时使用默认值80
+	Rows       int // 行数，小于等于0时使用默认值24
+	Scrollback int // 最多保存的历史行数，小于等于0时使用默认值10000
+	Logger     *log.Logger
+	Writer     io.Writer // 接收终端对查询序列（DSR、DA、DECRQSS 等）的应答，在代理中使用时应写回给应用程序
+
+	// 在备用屏幕被清除或切换回主屏幕之前保存备用屏幕的画面
+	CaptureAlternateScreen bool
 }
 
-func New() VirtualTerminal {
+// New 创建一个指定列数和行数的虚拟终端，例如 asciicast 头部中的 width 和 height。
+func New(cols, rows int) VirtualTerminal {
+	return NewWithOpts(Opts{Cols: cols, Rows: rows})
+}
+
+func NewWithOpts(opts Opts) VirtualTerminal {
+	if opts.Cols <= 0 {
+		opts.Cols = defaultCols
+	}
+	if opts.Rows <= 0 {
+		opts.Rows = defaultRows
+	}
+	if opts.Scrollback <= 0 {
+		opts.Scrollback = defaultScrollback
+	}
 	vt := virtualTerminal{
-		inputHandlers: make(map[byte]inputHandler),
-		rowList:       make([]*Row, 0),
-		rows:          0,
-		logger:        nil,
+		cols:          opts.Cols,
+		rows:          opts.Rows,
+		scrollback:    newScrollback(opts.Scrollback),
+		inputHandlers: make(map[string]inputHandler),
+		logger:        opts.Logger,
+		writer:        opts.Writer,
+
+		captureAlternate: opts.CaptureAlternateScreen,
 	}
+	vt.parser = newParser(&vt)
 	vt.initCsiHandler()
+	vt.resetState()
 	return &vt
 }
 
 type virtualTerminal struct {
-	rowList []*Row // 行数据
-	rows    int    // 行数量
+	cols int // 列数
+	rows int // 行数
+
+	screen     []*Row      // 当前使用的屏幕，固定为 rows 行
+	mainScreen []*Row      // 主屏幕
+	altScreen  []*Row      // 备用屏幕，全屏程序使用，不产生 scrollback
+	altActive  bool        // 是否正在使用备用屏幕
+	scrollback *scrollback // 滚出屏幕顶部的行
+
+	mainSavedCursor cursorState // 主屏幕保存的光标
+	altSavedCursor  cursorState // 备用屏幕保存的光标
+
+	captureAlternate bool     // 是否保存备用屏幕的画面
+	frames           [][]*Row // 保存的备用屏幕画面
+
+	x int // 光标所在列，从0开始
+	y int // 光标所在行，从0开始
+
+	attr      Attr       // 当前写入字符使用的显示属性
+	protected bool       // 当前写入字符是否受保护（DECSCA），受保护的字符不会被选择性擦除
+	link      *Hyperlink // 当前写入字符的超链接（OSC 8）
 
-	inputHandlers map[byte]inputHandler
-	insertMode    bool // 暂时没啥用
+	tabStops []bool // 每一列是否为制表位
+
+	charsets    [4]rune // G0-G3 字符集
+	gl          int     // 映射到 GL 的字符集
+	singleShift int     // 只对下一个字符生效的字符集，没有时为 noSingleShift
+
+	top    int // 滚动区域的第一行，从0开始
+	bottom int // 滚动区域的最后一行，从0开始
+
+	parser        *parser
+	inputHandlers map[string]inputHandler
+	insertMode    bool          // 插入模式（IRM），写入字符时右侧的字符向右移动
+	modes         map[Mode]bool // DEC 私有模式
+	wrapPending   bool          // 光标已写入最后一列，下一个字符写入前需要先换行
+	writer        io.Writer     // 接收终端的应答，例如 DSR、DA 和 DECRQM
 	logger        *log.Logger
 
-	currentDir string
+	session Session // shell 上报的会话信息
+
+	title        titleState    // 当前的窗口标题和图标名称
+	titleStack   []titleState  // CSI 22 t 保存的标题
+	titleHistory []TitleChange // 窗口标题的变化历史
+
+	shellIntegration bool            // 是否收到过 OSC 133
+	commands         []*commandMarks // OSC 133 划分出的命令
 }
 
-func (vt *virtualTerminal) addCsiHandler(b byte, handler inputHandler) {
-	vt.inputHandlers[b] = handler
+// 注册 CSI 处理器，id 由私有前缀、中间字符和最终字符组成，例如 "H"、"?h"、"$p"
+func (vt *virtualTerminal) addCsiHandler(id string, handler inputHandler) {
+	vt.inputHandlers[id] = handler
 }
 
-func (vt *virtualTerminal) getCurrentRow() *Row {
-	if len(vt.rowList) == 0 {
-		vt.rowList = append(vt.rowList, vt.newRow())
-		vt.rows = 1
+func (vt *virtualTerminal) initScreen() {
+	vt.mainScreen = make([]*Row, vt.rows)
+	vt.altScreen = make([]*Row, vt.rows)
+	for i := 0; i < vt.rows; i++ {
+		vt.mainScreen[i] = vt.newRow()
+		vt.altScreen[i] = vt.newRow()
 	}
+	vt.screen = vt.mainScreen
+	vt.altActive = false
+}
 
-	if len(vt.rowList) < vt.rows {
-		count := vt.rows - len(vt.rowList)
-		for i := 0; i < count; i++ {
-			vt.rowList = append(vt.rowList, vt.newRow())
-		}
-	}
+func (vt *virtualTerminal) getCurrentRow() *Row {
+	return vt.screen[vt.y]
+}
 
-	index := vt.rows - 1
-	if index < 0 {
-		index = 0
-	}
+func (vt *virtualTerminal) newRow() *Row {
+	return newRow(vt.cols)
+}
 
-	return vt.rowList[index]
+// 擦除或滚动产生的空行，与 xterm 一样使用当前的背景色（BCE）
+func (vt *virtualTerminal) blankRow() *Row {
+	row := newRow(vt.cols)
+	row.erase(0, vt.cols, vt.eraseAttr())
+	return row
 }
 
-func (vt *virtualTerminal) newRow() *Row {
-	return &Row{
-		data:  make([]rune, 0),
-		index: 0,
-	}
+// 写入字符时使用的显示属性、超链接和保护属性
+func (vt *virtualTerminal) pen() Cell {
+	return Cell{Attr: vt.attr, Link: vt.link, protected: vt.protected}
 }
 
-// https://zh.wikipedia.org/zh/ANSI%E8%BD%AC%E4%B9%89%E5%BA%8F%E5%88%97
-func (vt *virtualTerminal) handleSequence(inputs []byte) []byte {
-	code, size := utf8.DecodeRune(inputs)
-	inputs = inputs[size:]
-	switch code {
-	case '[': // CSI - 控制序列导入器（Control Sequence Introducer）
-		inputs = vt.handleCSISequence(inputs)
-	case ']': // OSC – 操作系统命令（Operating System Command）
-		inputs = vt.handleOSCSequence(inputs)
-	}
-	return inputs
-}
-
-func (vt *virtualTerminal) handleCSISequence(p []byte) []byte {
-	index := bytes.IndexFunc(p, func(r rune) bool {
-		return isCSISequence(r)
-	})
-	if index > -1 {
-		b := p[index]
-		handler, ok := vt.inputHandlers[b]
-		if ok {
-			params := []rune(string(p[:index]))
-			if err := handler(params); err != nil {
-				vt.log(fmt.Sprintf("handle csi sequence err %v", err.Error()))
-			}
-		} else {
-			vt.log(fmt.Sprintf("no match input handler for %q %v", b, b))
-		}
-	}
-	return p[index+1:]
-}
-
-// 启动操作系统使用的控制字符串。OSC序列与CSI序列相似，但不限于整数参数。
-// 通常，这些控制序列由ST终止[12]:8.3.89。
-// 在xterm中，它们也可能被BEL终止[13]。
-// 例如，在xterm中，窗口标题可以这样设置：OSC 0;this is the window title _BEL。
-func (vt *virtualTerminal) handleOSCSequence(p []byte) []byte {
-	idx := bytes.IndexRune(p, _SEMICOLON)
-	if idx >= 0 {
-		osc, _ := strconv.Atoi(string(p[:idx]))
-		switch osc {
-		case 1337:
-			content := string(p[idx+1:])
-			parts := strings.Split(content, "=")
-			if len(parts) == 2 {
-				vt.currentDir = parts[1]
-			}
-		}
+// 擦除字符时使用的显示属性，只保留当前的背景色
+func (vt *virtualTerminal) eraseAttr() Attr {
+	return Attr{Bg: vt.attr.Bg}
+}
+
+func (vt *virtualTerminal) print(code rune) {
+	vt.appendCharacter(vt.translateCharset(code))
+}
+
+func (vt *virtualTerminal) execute(code rune) {
+	vt.handleC0Sequence(code)
+}
+
+// CSI - 控制序列导入器（Control Sequence Introducer）
+func (vt *virtualTerminal) csiDispatch(params, intermediates []rune, final rune) {
+	seq := parseCSISequence(params, intermediates, final)
+	handler, ok := vt.inputHandlers[seq.id()]
+	if !ok {
+		vt.log(fmt.Sprintf("no match input handler for %v", seq))
+		return
 	}
-	if index := bytes.IndexRune(p, _ST); index >= 0 {
-		return p[index+1:]
+	if err := handler(seq); err != nil {
+		vt.log(fmt.Sprintf("handle csi sequence err %v", err.Error()))
 	}
-	if index := bytes.IndexRune(p, _BEL); index >= 0 {
-		return p[index+1:]
+}
+
+// OSC – 操作系统命令（Operating System Command）
+func (vt *virtualTerminal) oscDispatch(data []rune) {
+	vt.handleOSCSequence(string(data))
+}
+
+// DCS – 设备控制字符串（Device Control String）
+func (vt *virtualTerminal) dcsDispatch(params, intermediates []rune, final rune, data []rune) {
+	id := string(params) + string(intermediates) + string(final)
+	switch id {
+	case "$q":
+		vt.requestStatusString(string(data))
+	case "+q":
+		vt.requestTermcapString(string(data))
+	default:
+		vt.log(fmt.Sprintf("unsupported dcs sequence %q", id))
 	}
-	return p
 }
 
 // https://zh.wikipedia.org/zh/C0%E4%B8%8EC1%E6%8E%A7%E5%88%B6%E5%AD%97%E7%AC%A6
@@ -159,86 +250,249 @@ func (vt *virtualTerminal) handleC0Sequence(code rune) {
 	case _BS: // \b 将光标向左移动一个字符
 		vt.moveBackward(1)
 	case _HT: // \t 定位到下一个制表位。
-		// TODO
+		vt.tabForward(1)
 	case _LF: // \n 将光标移动到下一行,但不改变所在的列的位置
-		vt.moveDown(1)
-	case _VT: // \v 定位到下一行的制表位。
-		// TODO
+		vt.lineFeed()
+	case _VT, _FF: // \v 定位到下一行的制表位。与 xterm 一致，按换行处理
+		vt.lineFeed()
 	case _CR: // \r 将光标移动到当前行的最左边。
-		vt.moveTo(0, vt.rows)
+		vt.setCol(0)
+	case _SO: // 使用 G1 字符集
+		vt.invokeCharset(1)
+	case _SI: // 使用 G0 字符集
+		vt.invokeCharset(0)
 	case _DEL: // 最初用于穿孔纸带上删除一个字符。因为任何位置的字符都可以被全部穿孔（全1）。VT100兼容终端，按键⌫产生这个字符，常称为backspace，但不对应于PC键盘的delete key。
 		// TODO
 	}
 }
 
+// 将应答写入 Writer，没有设置 Writer 时忽略
+func (vt *virtualTerminal) reply(s string) {
+	if vt.writer == nil {
+		return
+	}
+	if _, err := io.WriteString(vt.writer, s); err != nil {
+		vt.log(fmt.Sprintf("write reply err %v", err.Error()))
+	}
+}
+
 func (vt *virtualTerminal) log(v ...interface{}) {
 	if vt.logger != nil {
-		log.Println(v...)
+		vt.logger.Println(v...)
+	}
+}
+
+func (vt *virtualTerminal) appendCharacter(code rune) {
+	width := runeWidth(code)
+	if row, col, ok := vt.previousCell(); ok && continuesGrapheme(row.cells[col].Text, code) {
+		vt.appendToCell(row, col, code, width)
+		return
+	}
+	if width == 0 {
+		// 前面没有可以附加的字符时单独占用一列
+		width = 1
 	}
+	if width > vt.cols {
+		width = 1
+	}
+	if vt.wrapPending {
+		// 与 xterm 一致，写满最后一列后并不立即换行，而是在下一个字符到来时才换行
+		vt.wrapLine()
+	}
+	if vt.x+width > vt.cols {
+		// 宽字符在最后一列放不下时，提前换行；未开启自动换行时写在倒数第二列
+		if vt.mode(ModeAutoWrap) {
+			vt.getCurrentRow().skipped = true
+			vt.wrapLine()
+		} else {
+			vt.setCol(vt.cols - width)
+		}
+	}
+	row := vt.getCurrentRow()
+	if vt.insertMode {
+		// 超出右边界的字符被丢弃
+		row.insert(vt.x, width, vt.eraseAttr())
+	}
+	row.set(vt.x, code, width, vt.pen())
+	vt.advanceCursor(width)
 }
 
-func (vt *virtualTerminal) getNumberOrDefault(params []rune, index, _default int) int {
-	// 下标检查
-	if len(params)-1 < index {
-		return _default
+// 光标左侧最近写入的字符单元，组合字符将附加到这个单元
+func (vt *virtualTerminal) previousCell() (*Row, int, bool) {
+	row := vt.getCurrentRow()
+	col := vt.x - 1
+	if vt.wrapPending {
+		col = vt.x
 	}
-	n, err := strconv.Atoi(string(params[index]))
-	if err != nil {
-		n = _default
+	for col >= 0 && row.cells[col].IsPlaceholder() {
+		col--
 	}
-	return n
+	return row, col, col >= 0
 }
 
-func (vt *virtualTerminal) getNumberOrDefaultOfBytes(params []byte, index, _default int) int {
-	// 下标检查
-	if len(params)-1 < index {
-		return _default
+// 将字符附加到前一个单元组成字素簇。
+// 字素簇最多占用两列，ZWJ 连接的 emoji 序列与第一个 emoji 同宽，附加时光标不移动
+func (vt *virtualTerminal) appendToCell(row *Row, col int, code rune, width int) {
+	if vt.wrapPending || col+row.cells[col].Width != vt.x || vt.x+width > vt.cols || row.cells[col].Width+width > 2 {
+		row.extend(col, code, 0)
+		return
+	}
+	if vt.insertMode && width > 0 {
+		row.insert(vt.x, width, vt.eraseAttr())
 	}
-	n, err := strconv.Atoi(string(params[index]))
-	if err != nil {
-		n = _default
+	row.extend(col, code, width)
+	if width > 0 {
+		vt.advanceCursor(width)
 	}
-	return n
 }
 
-func (vt *virtualTerminal) appendCharacter(code rune) {
-	row := vt.getCurrentRow()
-	row.append(code)
+// 写入字符后光标右移，到达最右侧后停留在最后一列
+func (vt *virtualTerminal) advanceCursor(width int) {
+	if vt.x+width >= vt.cols {
+		vt.setCol(vt.cols - 1)
+		vt.wrapPending = vt.mode(ModeAutoWrap)
+		return
+	}
+	vt.moveForward(width)
+}
+
+// 自动换行，当前行标记为延续到下一行
+func (vt *virtualTerminal) wrapLine() {
+	vt.getCurrentRow().wrapped = true
+	vt.setCol(0)
+	vt.lineFeed()
 }
 
 func (vt *virtualTerminal) Advance(p []byte) {
 	vt.advance(p)
 }
 
+// 输入可以在任意位置被拆分，未结束的控制序列和不完整的 UTF-8 字符会在下一次输入时继续解析
 func (vt *virtualTerminal) advance(inputs []byte) {
-	for len(inputs) > 0 {
-		code, size := utf8.DecodeRune(inputs)
-		inputs = inputs[size:]
-		if _ESC == code {
-			inputs = vt.handleSequence(inputs)
-			continue
-		}
-		if isC0Sequence(code) {
-			vt.handleC0Sequence(code)
-		} else {
-			vt.appendCharacter(code)
-		}
-	}
+	vt.parser.advance(inputs)
+}
+
+// scrollback 和主屏幕中已使用的行
+func (vt *virtualTerminal) outputRows() []*Row {
+	rows := vt.scrollback.list()
+	return append(rows, vt.mainScreen[:usedRows(vt.mainScreen)]...)
 }
 
+// Output 返回历史记录和主屏幕中的文本，自动换行产生的多行会被重新拼接为一行。
+// 备用屏幕中全屏程序的画面不会出现在结果中
 func (vt *virtualTerminal) Output() []string {
+	rows := vt.outputRows()
+
 	var result []string
-	for i := range vt.rowList {
-		line := vt.rowList[i].String()
-		result = append(result, line)
+	var line strings.Builder
+	for _, row := range rows {
+		if row.wrapped {
+			line.WriteString(row.slice(0, row.wrapEnd()))
+			continue
+		}
+		line.WriteString(row.String())
+		result = append(result, line.String())
+		line.Reset()
+	}
+	if line.Len() > 0 {
+		result = append(result, line.String())
 	}
 	return result
 }
 
+func (vt *virtualTerminal) HTML() string {
+	return RenderHTML(vt.outputRows())
+}
+
 func (vt *virtualTerminal) Reset() {
-	_ = vt.eraseAll()
+	vt.parser.reset()
+	vt.scrollback = newScrollback(vt.scrollback.limit)
+	vt.frames = nil
+	vt.session = Session{}
+	vt.title = titleState{}
+	vt.titleStack = nil
+	vt.titleHistory = nil
+	vt.shellIntegration = false
+	vt.commands = nil
+	vt.resetState()
+}
+
+// 将屏幕、光标、模式等恢复到初始状态，不影响 scrollback
+func (vt *virtualTerminal) resetState() {
+	vt.mainSavedCursor = cursorState{}
+	vt.altSavedCursor = cursorState{}
+	vt.initScreen()
+	vt.resetScrollRegion()
+	vt.resetTabStops()
+	vt.resetCharsets()
+	vt.attr = Attr{}
+	vt.protected = false
+	vt.link = nil
+	vt.modes = newModes()
+	vt.insertMode = false
+	vt.resetCursor()
 }
 
 func (vt *virtualTerminal) CurrentDir() string {
-	return vt.currentDir
+	return vt.session.CurrentDir
+}
+
+func (vt *virtualTerminal) CurrentHost() string {
+	return vt.session.Host
+}
+
+func (vt *virtualTerminal) Session() Session {
+	return vt.session.clone()
+}
+
+func (vt *virtualTerminal) Title() string {
+	return vt.title.title
+}
+
+func (vt *virtualTerminal) IconName() string {
+	return vt.title.iconName
+}
+
+func (vt *virtualTerminal) TitleHistory() []TitleChange {
+	return slices.Clone(vt.titleHistory)
+}
+
+func (vt *virtualTerminal) Commands() []CommandBlock {
+	blocks := make([]CommandBlock, 0, len(vt.commands))
+	for _, c := range vt.commands {
+		blocks = append(blocks, vt.commandBlock(c))
+	}
+	return blocks
+}
+
+func (vt *virtualTerminal) Screen() []*Row {
+	return cloneRows(vt.screen)
+}
+
+func (vt *virtualTerminal) Scrollback() []*Row {
+	return cloneRows(vt.scrollback.list())
+}
+
+func (vt *virtualTerminal) Line(n int) *Row {
+	row := vt.line(n)
+	if row == nil {
+		return nil
+	}
+	return row.clone()
+}
+
+func (vt *virtualTerminal) Mode(mode Mode) bool {
+	return vt.mode(mode)
+}
+
+func (vt *virtualTerminal) AlternateScreen() bool {
+	return vt.altActive
+}
+
+func (vt *virtualTerminal) AlternateFrames() [][]*Row {
+	frames := make([][]*Row, 0, len(vt.frames))
+	for _, frame := range vt.frames {
+		frames = append(frames, cloneRows(frame))
+	}
+	return frames
 }
@@ -1,7 +1,9 @@
 package vt
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 	"unicode/utf8"
 )
@@ -18,7 +20,7 @@ func TestParser(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		terminal := New()
+		terminal := New(80, 24)
 		terminal.Advance([]byte(test.in))
 		out := terminal.Output()
 		if !testEq(out, test.out) {
@@ -27,6 +29,1016 @@ func TestParser(t *testing.T) {
 	}
 }
 
+func TestScreen(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		// 光标在屏幕边缘停止移动
+		{"\x1b[9Aab\x1b[9Dc", []string{"cb"}},
+		{"\x1b[?7labcdefgh", []string{"abcdh"}},
+		{"a\x1b[9Bb", []string{"a", "", " b"}},
+		// 在最后一行换行时，顶部的行滚入历史记录
+		{"1\r\n2\r\n3\r\n4\r\n5", []string{"1", "2", "3", "4", "5"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestAutoWrap(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"abcdefgh", []string{"abcdefgh"}},
+		{"ab de fg", []string{"ab de fg"}},
+		// 写满最后一列后光标停留在原地，直到下一个字符到来
+		{"abcde\r\nf", []string{"abcde", "f"}},
+		{"abcde\rx", []string{"xbcde"}},
+		{"abcde\x1b[?7lfg\x1b[?7hhi", []string{"abcdhi"}},
+		{"abcdefghijklmnopq", []string{"abcdefghijklmnopq"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestScrollback(t *testing.T) {
+	var tests = []struct {
+		in         string
+		out        []string
+		scrollback []string
+	}{
+		{"1\r\n2\r\n3\r\n4\r\n5", []string{"2", "3", "4", "5"}, []string{"2", "3"}},
+		// 清屏时屏幕内容进入 scrollback
+		{"1\r\n2\x1b[2J", []string{"1", "2"}, []string{"1", "2"}},
+		{"1\r\n2\r\n3\x1b[2J\x1b[3J", nil, nil},
+		{"1\r\n2\r\n3\x1b[3J\r\n4", []string{"2", "3", "4"}, []string{"2"}},
+	}
+
+	for _, test := range tests {
+		terminal := NewWithOpts(Opts{Cols: 5, Rows: 2, Scrollback: 2})
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+		var scrollback []string
+		for _, row := range terminal.Scrollback() {
+			scrollback = append(scrollback, row.String())
+		}
+		if !testEq(scrollback, test.scrollback) {
+			t.Errorf("%q: expected scrollback %#v got %#v", test.in, test.scrollback, scrollback)
+		}
+	}
+}
+
+func TestScrollRegion(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		// 设置滚动区域后光标回到左上角
+		{"1\r\n2\r\n3\r\n4\x1b[2;3rx", []string{"x", "2", "3", "4"}},
+		// 在滚动区域最后一行换行只滚动区域内的内容
+		{"1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[2B\nx", []string{"1", "3", "x", "4"}},
+		// 光标向下移动不会超过滚动区域
+		{"1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[9B\x1b[Kx", []string{"1", "2", "x", "4"}},
+		// 在滚动区域第一行反向换行
+		{"1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[B\x1bMx", []string{"1", "x", "2", "4"}},
+		// 滚动区域从第一行开始时，滚出的行进入 scrollback
+		{"1\r\n2\r\n3\r\n4\x1b[1;2r\n\nx", []string{"1", "2", "x", "3", "4"}},
+		// 无效的滚动区域被忽略
+		{"1\r\n2\r\n3\r\n4\x1b[3;2r\r\nx", []string{"1", "2", "3", "4", "x"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 4)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestInsertDeleteLines(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"1\r\n2\r\n3\r\n4\x1b[2;2H\x1b[Lx", []string{"1", "x", "2", "3"}},
+		{"1\r\n2\r\n3\r\n4\x1b[2;2H\x1b[Mx", []string{"1", "x", "4"}},
+		{"1\r\n2\r\n3\r\n4\x1b[2H\x1b[9M", []string{"1"}},
+		// 只影响滚动区域内的行
+		{"1\r\n2\r\n3\r\n4\x1b[1;3r\x1b[2H\x1b[2L", []string{"1", "", "", "4"}},
+		{"1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[2H\x1b[M", []string{"1", "3", "", "4"}},
+		// 光标不在滚动区域内时无效
+		{"1\r\n2\r\n3\r\n4\x1b[1;2r\x1b[4H\x1b[Lx", []string{"1", "2", "3", "x"}},
+		// 滚动不移动光标，从第一行开始滚动时滚出的行进入 scrollback
+		{"1\r\n2\r\n3\r\n4\x1b[2Sx", []string{"1", "2", "3", "4", "", " x"}},
+		{"1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[S", []string{"1", "3", "", "4"}},
+		{"1\r\n2\r\n3\r\n4\x1b[T", []string{"", "1", "2", "3"}},
+		{"1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[0T", []string{"1", "", "2", "4"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 4)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+
+	// 插入和滚动产生的空行使用当前的背景色
+	var rowTests = []struct {
+		in  string
+		row int
+	}{
+		{"a\x1b[44m\x1b[L", 0},
+		{"a\r\nb\x1b[44m\x1b[1H\x1b[M", 3},
+		{"a\x1b[44m\x1b[S", 3},
+		{"a\x1b[44m\x1b[T", 0},
+		{"\x1b[44m\n\n\n\n", 3},
+	}
+	for _, test := range rowTests {
+		terminal := New(5, 4)
+		terminal.Advance([]byte(test.in))
+		cell := terminal.Screen()[test.row].Cell(4)
+		if !cell.IsBlank() || cell.Attr != (Attr{Bg: IndexedColor(4)}) {
+			t.Errorf("%q: expected blank cell with background 4 got %+v", test.in, cell)
+		}
+	}
+}
+
+func TestErase(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"abcdef\x1b[2G\x1b[K", []string{"a"}},
+		// EL 1 将光标左侧的字符置为空格，其余字符位置不变
+		{"abcdef\x1b[3G\x1b[1K", []string{"   def"}},
+		// EL 2 只清除光标所在的行
+		{"abcdef\r\nxyz\x1b[1;3H\x1b[2K", []string{"", "xyz"}},
+		{"abc\r\ndef\x1b[1;2H\x1b[1J", []string{"  c", "def"}},
+		{"abc\r\ndef\x1b[1;2H\x1b[J", []string{"a"}},
+		// ECH 不移动右侧的字符
+		{"abcdef\x1b[2G\x1b[2X", []string{"a  def"}},
+		{"abcdef\x1b[2G\x1b[0X", []string{"a cdef"}},
+		{"abcdef\x1b[4G\x1b[99X", []string{"abc"}},
+		// 选择性擦除保留受保护的字符
+		{"a\x1b[1\"qbc\x1b[0\"qd\x1b[?2K", []string{" bc"}},
+		{"a\x1b[1\"qbc\x1b[\"qd\x1b[2K\r\nx", []string{"", "x"}},
+		{"x\x1b[1\"qbc\r\nd\x1b[2\"qe\x1b[?2J", []string{" bc", "d"}},
+		{"ab\x1b[1\"qc\x1b[0\"qd\r\nef\x1b[1;2H\x1b[?J", []string{"a c"}},
+		{"ab\x1b[1\"qc\x1b[0\"qd\r\nef\x1b[?1J", []string{"  c"}},
+		// DECSC 保存字符保护属性
+		{"\x1b[1\"q\x1b7\x1b[0\"q\x1b8ab\x1b[?2K", []string{"ab"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(10, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+
+	var attrTests = []struct {
+		in   string
+		col  int
+		attr Attr
+	}{
+		// 擦除的字符使用当前的背景色
+		{"\x1b[1;41mab\x1b[1K", 0, Attr{Bg: IndexedColor(1)}},
+		{"ab\x1b[44m\x1b[1G\x1b[X", 0, Attr{Bg: IndexedColor(4)}},
+		{"ab\x1b[44m\x1b[2K", 5, Attr{Bg: IndexedColor(4)}},
+		{"ab\x1b[44m\x1b[2J", 5, Attr{Bg: IndexedColor(4)}},
+		{"ab\x1b[44m\x1b[1G\x1b[2@", 1, Attr{Bg: IndexedColor(4)}},
+		{"ab\x1b[44m\x1b[1G\x1b[P", 9, Attr{Bg: IndexedColor(4)}},
+		// 选择性擦除保留原有的显示属性
+		{"\x1b[1ma\x1b[0m\x1b[?1K", 0, Attr{Bold: true}},
+	}
+
+	for _, test := range attrTests {
+		terminal := New(10, 3)
+		terminal.Advance([]byte(test.in))
+		cell := terminal.Screen()[0].Cell(test.col)
+		if !cell.IsBlank() || cell.Attr != test.attr {
+			t.Errorf("%q: expected blank cell with %+v got %+v", test.in, test.attr, cell)
+		}
+	}
+}
+
+func TestCharAttributes(t *testing.T) {
+	var tests = []struct {
+		in   string
+		col  int
+		attr Attr
+	}{
+		{"a", 0, Attr{}},
+		{"\x1b[1;31ma", 0, Attr{Bold: true, Fg: IndexedColor(1)}},
+		{"\x1b[1;31ma\x1b[0mb", 1, Attr{}},
+		{"\x1b[2;3;4;5;7;8;9ma", 0, Attr{Dim: true, Italic: true, Underline: UnderlineSingle, Blink: true, Inverse: true, Hidden: true, Strikethrough: true}},
+		{"\x1b[1;2;3;4;5;7;8;9m\x1b[22;23;24;25;27;28;29ma", 0, Attr{}},
+		{"\x1b[21ma", 0, Attr{Underline: UnderlineDouble}},
+		{"\x1b[92;104ma", 0, Attr{Fg: IndexedColor(10), Bg: IndexedColor(12)}},
+		{"\x1b[38;5;208;48;2;1;2;3ma", 0, Attr{Fg: IndexedColor(208), Bg: RGBColor(1, 2, 3)}},
+		{"\x1b[31;42m\x1b[39;49ma", 0, Attr{}},
+		{"\x1b[31m\x1b[ma", 0, Attr{}},
+		// 下划线颜色的参数不会被当作其他属性
+		{"\x1b[1;58;2;255;0;0ma", 0, Attr{Bold: true}},
+		{"\x1b[1;58;5;9;4ma", 0, Attr{Bold: true, Underline: UnderlineSingle}},
+		{"\x1b[58:2::1:2:3;1;59ma", 0, Attr{Bold: true}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 3)
+		terminal.Advance([]byte(test.in))
+		attr := terminal.Screen()[0].Cell(test.col).Attr
+		if attr != test.attr {
+			t.Errorf("%q: expected %+v got %+v", test.in, test.attr, attr)
+		}
+	}
+}
+
+func TestCells(t *testing.T) {
+	terminal := New(5, 3)
+	terminal.Advance([]byte("a\x1b[1mb"))
+	row := terminal.Screen()[0]
+	if row.Len() != 5 {
+		t.Fatalf("expected 5 cells got %d", row.Len())
+	}
+	expected := []Cell{
+		{Text: "a", Width: 1},
+		{Text: "b", Width: 1, Attr: Attr{Bold: true}},
+		{Text: " ", Width: 1},
+	}
+	for i, cell := range expected {
+		if row.Cell(i) != cell {
+			t.Errorf("cell %d: expected %+v got %+v", i, cell, row.Cell(i))
+		}
+	}
+	if row.Cell(1).Rune() != 'b' || !row.Cell(9).IsBlank() {
+		t.Errorf("unexpected cell accessors")
+	}
+	if row.String() != "ab" {
+		t.Errorf("expected %q got %q", "ab", row.String())
+	}
+}
+
+func TestWideCharacter(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"你好", []string{"你好"}},
+		// 光标移动按列计算，宽字符占用两列
+		{"你好\x1b[4Db", []string{"b 好"}},
+		{"你好\x1b[3Gb", []string{"你b"}},
+		{"🍺 a\x1b[2Gb", []string{" b a"}},
+		// 最后一列放不下宽字符时提前换行，最后一列保留为空白，拼接时被跳过
+		{"ab你好", []string{"ab你好"}},
+		{"abcd你", []string{"abcd你"}},
+		{"你好你好", []string{"你好你好"}},
+		// 被跳过的列写入字符后属于文本
+		{"ab你好\x1b[1;5Hx", []string{"ab你x好"}},
+		{"ab你好\x1b[1;5H\x1b[K", []string{"ab你", "好"}},
+		{"\x1b[?7labcd你", []string{"abc你"}},
+		{"你好\r\x1b[2@", []string{"  你"}},
+		{"你好\r\x1b[P", []string{" 好"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+
+	terminal := New(5, 3)
+	terminal.Advance([]byte("你"))
+	row := terminal.Screen()[0]
+	if row.Cell(0).Width != 2 || !row.Cell(1).IsPlaceholder() {
+		t.Errorf("expected wide cell and placeholder got %+v %+v", row.Cell(0), row.Cell(1))
+	}
+
+	// 命令输出和 HTML 同样跳过提前换行留下的空白
+	terminal = New(5, 3)
+	terminal.Advance([]byte("\x1b]133;C\x07你好你好\r\n\x1b]133;D\x07"))
+	if blocks := terminal.Commands(); len(blocks) != 1 || !testEq(blocks[0].Output, []string{"你好你好"}) {
+		t.Errorf("unexpected command blocks %+v", blocks)
+	}
+	expected := `<pre style="color:#e5e5e5;background-color:#000000">你好你好</pre>`
+	if html := terminal.HTML(); html != expected {
+		t.Errorf("expected %s got %s", expected, html)
+	}
+}
+
+func TestGraphemeCluster(t *testing.T) {
+	var tests = []struct {
+		in   string
+		out  []string
+		text string // 第一个单元的内容
+	}{
+		{"e\u0301x", []string{"e\u0301x"}, "e\u0301"},
+		{"e\u0301\u0327", []string{"e\u0301\u0327"}, "e\u0301\u0327"},
+		// 光标按列移动，组合字符不占用列
+		{"e\u0301x\x1b[2Gy", []string{"e\u0301y"}, "e\u0301"},
+		{"\u2764\ufe0fx", []string{"\u2764\ufe0fx"}, "\u2764\ufe0f"},
+		{"👍🏽x", []string{"👍🏽x"}, "👍🏽"},
+		{"👨\u200d👩x", []string{"👨\u200d👩x"}, "👨\u200d👩"},
+		{"\u2764\ufe0f\u200d🔥x", []string{"\u2764\ufe0f\u200d🔥x"}, "\u2764\ufe0f\u200d🔥"},
+		// ZWJ 只连接 emoji
+		{"a\u200d你", []string{"a\u200d你"}, "a\u200d"},
+		{"👍\u200d你", []string{"👍\u200d你"}, "👍\u200d"},
+		// 关闭自动换行时，覆盖最后一列不会清除前面的字符
+		{"\x1b[?7lab\u200d你好", []string{"ab\u200d 好"}, "a"},
+		{"🇨🇳🇺🇸", []string{"🇨🇳🇺🇸"}, "🇨🇳"},
+		// 写满最后一列后仍然附加到最后一个字符
+		{"abcde\u0301", []string{"abcde\u0301"}, "a"},
+		{"\u0301a", []string{"\u0301a"}, "\u0301"},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+		if text := terminal.Screen()[0].Cell(0).Text; text != test.text {
+			t.Errorf("%q: expected first cell %q got %q", test.in, test.text, text)
+		}
+	}
+}
+
+func TestChunkBoundary(t *testing.T) {
+	var tests = []struct {
+		chunks []string
+		out    []string
+	}{
+		{[]string{"abc\x1b[", "2Dx"}, []string{"axc"}},
+		{[]string{"abc\x1b", "[1", "0Dx"}, []string{"xbc"}},
+		{[]string{"\xe4\xbd", "\xa0\xe5\xa5\xbd"}, []string{"你好"}},
+		{[]string{"a\x1b]0;tit", "le\x07b"}, []string{"ab"}},
+		{[]string{"a\x1b]0;title\x1b", "\\b"}, []string{"ab"}},
+		{[]string{"a\x1bP1$r0m\x1b\\", "b"}, []string{"ab"}},
+		// 控制序列中出现 CAN 时中断该序列
+		{[]string{"a\x1b[1\x18", "b"}, []string{"ab"}},
+		// 控制序列中的 C0 控制字符立即执行
+		{[]string{"ab\x1b[\b", "Cx"}, []string{"abx"}},
+		// 未结束的控制序列不会输出任何内容
+		{[]string{"a\x1b[1;"}, []string{"a"}},
+		// C1 控制字符与7位的 ESC 序列相同
+		{[]string{"a\u009b2Cb"}, []string{"a  b"}},
+		{[]string{"a\u009d0;title\u009cb"}, []string{"ab"}},
+		{[]string{"a\u009d0;title\ab\u0085c"}, []string{"ab", "c"}},
+		{[]string{"a\u009f", "x\u009cb\u0080"}, []string{"ab"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(10, 3)
+		for _, chunk := range test.chunks {
+			terminal.Advance([]byte(chunk))
+		}
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.chunks, test.out, out)
+		}
+
+		// 逐字节输入的结果应与一次性输入相同
+		terminal = New(10, 3)
+		for _, b := range []byte(strings.Join(test.chunks, "")) {
+			terminal.Advance([]byte{b})
+		}
+		out = terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q byte by byte: expected %#v got %#v", test.chunks, test.out, out)
+		}
+	}
+}
+
+func TestCSISequence(t *testing.T) {
+	var tests = []struct {
+		params        string
+		intermediates string
+		final         rune
+		id            string
+		seq           string
+	}{
+		{"12;34", "", 'H', "H", "CSI 12;34H"},
+		{";5", "", 'H', "H", "CSI ;5H"},
+		{"?25", "", 'l', "?l", "CSI ?25l"},
+		{">", "", 'c', ">c", "CSI >c"},
+		{"?2026", "$", 'p', "?$p", "CSI ?2026$p"},
+		{"38:2::255:0:0", "", 'm', "m", "CSI 38:2::255:0:0m"},
+	}
+	for _, test := range tests {
+		seq := parseCSISequence([]rune(test.params), []rune(test.intermediates), test.final)
+		if seq.id() != test.id || seq.String() != test.seq {
+			t.Errorf("%q: expected %q %q got %q %q", test.params, test.id, test.seq, seq.id(), seq.String())
+		}
+	}
+
+	seq := parseCSISequence([]rune("12;;4:3"), nil, 'm')
+	if seq.getNumberOrDefault(0, 1) != 12 || seq.getNumberOrDefault(1, 7) != 7 || seq.getNumberOrDefault(5, 9) != 9 {
+		t.Errorf("unexpected params %v", seq.params)
+	}
+
+	var outputs = []struct {
+		in  string
+		out []string
+	}{
+		{"\x1b[2;12Hx", []string{"", "           x"}},
+		// 带私有前缀或中间字符的序列不会被分发到同名的处理器
+		{"a\x1b[>5Cb\x1b[1 Cc", []string{"abc"}},
+		{"a\x1b[?4hb", []string{"ab"}},
+		// 参数为0时视为1
+		{"abc\r\x1b[0@x", []string{"xabc"}},
+		{"abc\r\x1b[0Px", []string{"xc"}},
+	}
+	for _, test := range outputs {
+		terminal := New(20, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+
+	var attrs = []struct {
+		in   string
+		attr Attr
+	}{
+		{"\x1b[38:2::255:0:0ma", Attr{Fg: RGBColor(255, 0, 0)}},
+		{"\x1b[38:2:1:2:3;48:5:200ma", Attr{Fg: RGBColor(1, 2, 3), Bg: IndexedColor(200)}},
+		{"\x1b[4:3ma", Attr{Underline: UnderlineCurly}},
+		{"\x1b[4:0ma", Attr{}},
+	}
+	for _, test := range attrs {
+		terminal := New(20, 3)
+		terminal.Advance([]byte(test.in))
+		if attr := terminal.Screen()[0].Cell(0).Attr; attr != test.attr {
+			t.Errorf("%q: expected %+v got %+v", test.in, test.attr, attr)
+		}
+	}
+}
+
+func TestAlternateScreen(t *testing.T) {
+	var tests = []struct {
+		in     string
+		out    []string
+		screen string // 当前屏幕第一行
+		alt    bool
+	}{
+		{"$ vim\r\n\x1b[?1049h\x1b[Hfile", []string{"$ vim"}, "file", true},
+		// 退出备用屏幕后恢复光标位置
+		{"$ vim\r\n\x1b[?1049h\x1b[Hfile\r\n\r\n\x1b[?1049l$ ls", []string{"$ vim", "$ ls"}, "$ vim", false},
+		{"ab\x1b[?1047hc\x1b[?1047ld", []string{"ab d"}, "ab d", false},
+		// 47 不清除备用屏幕
+		{"\x1b[?47hab\x1b[?47l\x1b[?47hc", nil, "abc", true},
+		{"\x1b[?1049hab\x1b[?1049l\x1b[?1049hc", nil, "c", true},
+		// 备用屏幕滚动时不产生 scrollback
+		{"\x1b[?1049h1\r\n2\r\n3\r\n4\x1b[?1049l", nil, "", false},
+	}
+
+	for _, test := range tests {
+		terminal := New(10, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+		if screen := terminal.Screen()[0].String(); screen != test.screen {
+			t.Errorf("%q: expected screen %q got %q", test.in, test.screen, screen)
+		}
+		if terminal.AlternateScreen() != test.alt {
+			t.Errorf("%q: expected alternate screen %v", test.in, test.alt)
+		}
+	}
+
+	terminal := NewWithOpts(Opts{Cols: 10, Rows: 3, CaptureAlternateScreen: true})
+	terminal.Advance([]byte("\x1b[?1049hframe 1\x1b[2J\x1b[Hframe 2\x1b[?1049l"))
+	frames := terminal.AlternateFrames()
+	if len(frames) != 2 || frames[0][0].String() != "frame 1" || frames[1][0].String() != "frame 2" {
+		t.Errorf("unexpected frames %v", frames)
+	}
+}
+
+func TestPrivateModes(t *testing.T) {
+	var buf bytes.Buffer
+	terminal := NewWithOpts(Opts{Cols: 10, Rows: 5, Writer: &buf})
+	if !terminal.Mode(ModeAutoWrap) || !terminal.Mode(ModeCursorVisible) || terminal.Mode(ModeBracketedPaste) {
+		t.Errorf("unexpected default modes")
+	}
+
+	terminal.Advance([]byte("\x1b[?25l\x1b[?1;2004;1004h\x1b[?1000h\x1b[?1003h\x1b[?1006h"))
+	expected := map[Mode]bool{
+		ModeCursorVisible:  false,
+		ModeCursorKeys:     true,
+		ModeBracketedPaste: true,
+		ModeFocusEvents:    true,
+		ModeMouseNormal:    false, // 鼠标上报模式互斥
+		ModeMouseAnyEvent:  true,
+		ModeMouseSGR:       true,
+	}
+	for mode, value := range expected {
+		if terminal.Mode(mode) != value {
+			t.Errorf("mode %d: expected %v", mode, value)
+		}
+	}
+
+	var replies = []struct {
+		in  string
+		out string
+	}{
+		{"\x1b[?2004$p", "\x1b[?2004;1$y"},
+		{"\x1b[?2026$p", "\x1b[?2026;2$y"},
+		{"\x1b[?1049h\x1b[?1049$p", "\x1b[?1049;1$y"},
+		{"\x1b[?9999$p", "\x1b[?9999;0$y"},
+		{"\x1b[4h\x1b[4$p", "\x1b[4;1$y"},
+		{"\x1b[20$p", "\x1b[20;4$y"},
+	}
+	for _, test := range replies {
+		buf.Reset()
+		terminal.Advance([]byte(test.in))
+		if buf.String() != test.out {
+			t.Errorf("%q: expected %q got %q", test.in, test.out, buf.String())
+		}
+	}
+
+	// 原点模式下光标位置相对于滚动区域
+	terminal = New(10, 5)
+	terminal.Advance([]byte("\x1b[2;4r\x1b[?6hA\x1b[9;2HB"))
+	out := terminal.Output()
+	if !testEq(out, []string{"", "A", "", " B"}) {
+		t.Errorf("unexpected origin mode output %#v", out)
+	}
+}
+
+func TestReports(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"\x1b[5n", "\x1b[0n"},
+		{"ab\r\nc\x1b[6n", "\x1b[2;2R"},
+		{"\x1b[3;5H\x1b[?6n", "\x1b[?3;5;1R"},
+		// 原点模式下行号相对于滚动区域
+		{"\x1b[2;4r\x1b[?6h\x1b[2;3H\x1b[6n", "\x1b[2;3R"},
+		{"\x1b[c", "\x1b[?62;22c"},
+		{"\x1b[0c", "\x1b[?62;22c"},
+		{"\x1bZ", "\x1b[?62;22c"},
+		{"\x1b[>c", "\x1b[>1;10;0c"},
+		{"\x1b[>q", "\x1bP>|vt-go\x1b\\"},
+		// DECRQSS
+		{"\x1b[1;4:3;38;5;196;41m\x1bP$qm\x1b\\", "\x1bP1$r0;1;4:3;38;5;196;41m\x1b\\"},
+		{"\x1b[38;2;1;2;3;95m\x1bP$qm\x1b\\", "\x1bP1$r0;95m\x1b\\"},
+		{"\x1bP$qm\x1b\\", "\x1bP1$r0m\x1b\\"},
+		{"\x1b[2;4r\x1bP$qr\x1b\\", "\x1bP1$r2;4r\x1b\\"},
+		{"\x1b[1\"q\x1bP$q\"q\x1b\\", "\x1bP1$r1\"q\x1b\\"},
+		{"\x1bP$qx\x1b\\", "\x1bP0$r\x1b\\"},
+		// XTGETTCAP
+		{"\x1bP+q544e\x1b\\", "\x1bP1+r544e=787465726D2D323536636F6C6F72\x1b\\"},
+		{"\x1bP+q436f;524742\x1b\\", "\x1bP1+r436f=323536;524742=38\x1b\\"},
+		{"\x1bP+q5858\x1b\\", "\x1bP0+r\x1b\\"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		terminal := NewWithOpts(Opts{Cols: 10, Rows: 5, Writer: &buf})
+		terminal.Advance([]byte(test.in))
+		if buf.String() != test.out {
+			t.Errorf("%q: expected %q got %q", test.in, test.out, buf.String())
+		}
+	}
+
+	// 没有设置 Writer 时忽略查询
+	terminal := New(10, 5)
+	terminal.Advance([]byte("\x1b[6n\x1b[cab"))
+	if out := terminal.Output(); !testEq(out, []string{"ab"}) {
+		t.Errorf("unexpected output %#v", out)
+	}
+}
+
+func TestInsertMode(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"abc\r\x1b[4hxy", []string{"xyabc"}},
+		// 超出右边界的字符被丢弃
+		{"abcde\r\x1b[4hxy", []string{"xyabcde"}},
+		{"abcdefg\r\x1b[4hxy", []string{"xyabcdef"}},
+		{"abc\r\x1b[4h你", []string{"你abc"}},
+		{"abc\r\x1b[4hx\x1b[4ly", []string{"xybc"}},
+		// readline 在命令行中间插入字符
+		{"$ ls -l\x1b[3D\x1b[4ha\x1b[4l", []string{"$ lsa -l"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(8, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestTabStops(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"a\tb\tc", []string{"a       b       c"}},
+		{"all:\n\r\tgo build", []string{"all:", "        go build"}},
+		// 没有更多制表位时停在最后一列
+		{"\t\t\t\tx", []string{"                    x"}},
+		{"\x1b[3Cx\x1bH\r\ty", []string{"   xy"}},
+		{"\x1b[3g\tx", []string{"                    x"}},
+		{"\t\x1b[g\r\t\tx", []string{"                    x"}},
+		{"\x1b[2Ix\x1b[2Zy", []string{"        y       x"}},
+		{"\x1b[20G\x1b[2Zx", []string{"        x"}},
+		// 垂直制表符和换页符按换行处理
+		{"a\vb\fc", []string{"a", " b", "  c"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(21, 5)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestSaveCursor(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		// 保存光标，绘制右侧提示符后恢复
+		{"$ \x1b7\x1b[15G10:00\x1b8ls", []string{"$ ls          10:00"}},
+		{"$ \x1b[s\x1b[15G10:00\x1b[uls", []string{"$ ls          10:00"}},
+		{"\x1b[2;3H\x1b7\x1b[H\x1b8x", []string{"", "  x"}},
+		// 没有保存过时恢复到左上角
+		{"abc\x1b8x", []string{"xbc"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(20, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+
+	// 恢复显示属性和原点模式
+	terminal := New(20, 5)
+	terminal.Advance([]byte("\x1b[1;31m\x1b[2;4r\x1b[?6h\x1b7\x1b[0m\x1b[?6l\x1b8\x1b[Hx"))
+	row := terminal.Screen()[1]
+	if row.String() != "x" || row.Cell(0).Attr != (Attr{Bold: true, Fg: IndexedColor(1)}) {
+		t.Errorf("unexpected restored state %q %+v", row.String(), row.Cell(0).Attr)
+	}
+}
+
+func TestEscSequence(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"ab\x1bDc", []string{"ab", "  c"}},
+		{"ab\x1bEc", []string{"ab", "c"}},
+		// 在屏幕第一行反向换行时向下滚动
+		{"1\r\n2\x1b[H\x1bMx", []string{"x", "1", "2"}},
+		// ESC 之后的字符不会被当作下一个序列的一部分
+		{"a\x1b=b\x1b>c", []string{"abc"}},
+		{"a\x1b(Bb\x1b)0c", []string{"abc"}},
+		{"\x1b#8", []string{"EEEEE", "EEEEE", "EEEEE"}},
+		{"\x1b[1;2r\x1b#8x", []string{"xEEEE", "EEEEE", "EEEEE"}},
+		// 完全重置时屏幕内容保存到 scrollback
+		{"ab\x1b[1m\x1b[?7l\x1bcc", []string{"ab", "c"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(5, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+
+	terminal := New(5, 3)
+	terminal.Advance([]byte("\x1b=\x1b[1m\x1b[?7l\x1bcabcdefg"))
+	if terminal.Mode(ModeKeypadApplication) || !terminal.Mode(ModeAutoWrap) {
+		t.Errorf("expected modes to be reset")
+	}
+	if attr := terminal.Screen()[0].Cell(0).Attr; attr != (Attr{}) {
+		t.Errorf("expected attributes to be reset got %+v", attr)
+	}
+	terminal.Advance([]byte("\x1b="))
+	if !terminal.Mode(ModeKeypadApplication) {
+		t.Errorf("expected keypad application mode")
+	}
+}
+
+func TestCharset(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"\x1b(0lqqk\r\nx  x\r\nmqqj\x1b(B", []string{"┌──┐", "│  │", "└──┘"}},
+		{"\x1b(0q\x1b(Bq", []string{"─q"}},
+		// SO 和 SI 切换 G1 和 G0
+		{"\x1b)0a\x0eq\x0fq", []string{"a─q"}},
+		// 单次切换只对下一个字符生效
+		{"\x1b*0\x1bNqq", []string{"─q"}},
+		{"\x1b+0\x1boqq\x1b(B\x0f", []string{"──"}},
+		{"\x1b(A#", []string{"£"}},
+		// 非 ASCII 字符不受影响
+		{"\x1b(0你", []string{"你"}},
+		// 恢复光标时恢复字符集
+		{"\x1b(0\x1b7\x1b(Bq\x1b8q", []string{"─"}},
+	}
+
+	for _, test := range tests {
+		terminal := New(10, 3)
+		terminal.Advance([]byte(test.in))
+		out := terminal.Output()
+		if !testEq(out, test.out) {
+			t.Errorf("%q: expected %#v got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestWorkingDirectory(t *testing.T) {
+	var tests = []struct {
+		in   string
+		dir  string
+		host string
+	}{
+		{"\x1b]7;file://myhost/home/user/my%20dir\x07", "/home/user/my dir", "myhost"},
+		{"\x1b]7;file:///tmp\x1b\\", "/tmp", ""},
+		{"\x1b]7;file://a/tmp\x07\x1b]7;file://b/root\x07", "/root", "b"},
+		{"\x1b]1337;CurrentDir=/tmp/a=b\x07", "/tmp/a=b", ""},
+		// 不是 file URL 时忽略
+		{"\x1b]7;/tmp\x07", "", ""},
+		{"\x1b]7;file://a/tmp\x07\x1b]7;%zz\x07", "/tmp", "a"},
+		{"\x1b]7;file://a\x07", "", ""},
+		// 未编码的 # ? 和 % 属于路径
+		{"\x1b]7;file://h/tmp/a#b\x07", "/tmp/a#b", "h"},
+		{"\x1b]7;file://h/tmp/a?b\x07", "/tmp/a?b", "h"},
+		{"\x1b]7;file://h/tmp/100%\x07", "/tmp/100%", "h"},
+		{"\x1b]7;file://h/tmp/a%20b#1\x07", "/tmp/a b#1", "h"},
+	}
+
+	for _, test := range tests {
+		terminal := New(10, 3)
+		terminal.Advance([]byte(test.in))
+		if terminal.CurrentDir() != test.dir || terminal.CurrentHost() != test.host {
+			t.Errorf("%q: expected %q %q got %q %q", test.in, test.dir, test.host, terminal.CurrentDir(), terminal.CurrentHost())
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	terminal := New(10, 3)
+	terminal.Advance([]byte("\x1b]1337;RemoteHost=root@web-01\x07" +
+		"\x1b]1337;CurrentDir=/srv/a=b\x07" +
+		"\x1b]1337;ShellIntegrationVersion=14;shell=zsh\x07" +
+		"\x1b]1337;SetUserVar=env=cHJvZA==\x07" +
+		"\x1b]1337;SetUserVar=bad=!!!\x07" +
+		"a\x1b]1337;SetMark\x07\r\nb\r\nc\r\nd\x1b]1337;SetMark\x07"))
+
+	expected := Session{
+		User:                    "root",
+		Host:                    "web-01",
+		CurrentDir:              "/srv/a=b",
+		UserVars:                map[string]string{"env": "prod"},
+		ShellIntegrationVersion: "14",
+		Shell:                   "zsh",
+		Marks:                   []int{0, 3},
+	}
+	session := terminal.Session()
+	if fmt.Sprint(session) != fmt.Sprint(expected) {
+		t.Errorf("expected %+v got %+v", expected, session)
+	}
+	if terminal.CurrentDir() != "/srv/a=b" || terminal.CurrentHost() != "web-01" {
+		t.Errorf("unexpected current dir %q host %q", terminal.CurrentDir(), terminal.CurrentHost())
+	}
+	if row := terminal.Line(session.Marks[1]); row == nil || row.String() != "d" {
+		t.Errorf("unexpected mark line %v", row)
+	}
+
+	// 返回的是副本
+	session.UserVars["env"] = "dev"
+	if terminal.Session().UserVars["env"] != "prod" {
+		t.Errorf("session should be copied")
+	}
+
+	terminal.Advance([]byte("\x1b]1337;RemoteHost=db-01\x07"))
+	if session := terminal.Session(); session.User != "" || session.Host != "db-01" {
+		t.Errorf("unexpected remote host %+v", session)
+	}
+
+	terminal.Reset()
+	if session := terminal.Session(); fmt.Sprint(session) != fmt.Sprint(Session{}) {
+		t.Errorf("expected empty session got %+v", session)
+	}
+
+	// 行号按屏幕上的行计算，包括自动换行的行和已从 scrollback 中丢弃的行
+	terminal = NewWithOpts(Opts{Cols: 5, Rows: 2, Scrollback: 1})
+	terminal.Advance([]byte("abcdefgh\r\n\x1b]1337;SetMark\x07x\r\n1\r\n2"))
+	marks := terminal.Session().Marks
+	if len(marks) != 1 || marks[0] != 2 {
+		t.Fatalf("unexpected marks %v", marks)
+	}
+	if row := terminal.Line(marks[0]); row == nil || row.String() != "x" {
+		t.Errorf("unexpected mark line %v", row)
+	}
+	if terminal.Line(0) != nil || terminal.Line(1) != nil || terminal.Line(5) != nil {
+		t.Errorf("expected nil for dropped rows and rows beyond the screen")
+	}
+	if row := terminal.Line(4); row == nil || row.String() != "2" {
+		t.Errorf("unexpected last line %v", row)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	terminal := New(10, 3)
+	first := "ab\x1b]0;root@web: ~\x07"
+	second := "你\x1b]2;vim\x1b\\\x1b]1;icon\x07"
+	terminal.Advance([]byte(first))
+	// 分多次输入时偏移量累加
+	terminal.Advance([]byte(second[:2]))
+	terminal.Advance([]byte(second[2:]))
+	if terminal.Title() != "vim" || terminal.IconName() != "icon" {
+		t.Errorf("unexpected title %q icon %q", terminal.Title(), terminal.IconName())
+	}
+
+	// 标题栈
+	terminal.Advance([]byte("\x1b[22t\x1b]0;top\x07\x1b]0;top\x07\x1b[23;2t"))
+	if terminal.Title() != "vim" || terminal.IconName() != "top" {
+		t.Errorf("unexpected title %q icon %q", terminal.Title(), terminal.IconName())
+	}
+	terminal.Advance([]byte("\x1b[22;1t\x1b]1;x\x07\x1b[23t\x1b[23t"))
+	if terminal.Title() != "vim" || terminal.IconName() != "top" {
+		t.Errorf("unexpected title %q icon %q", terminal.Title(), terminal.IconName())
+	}
+
+	n := int64(len(first) + len(second))
+	expected := []TitleChange{
+		{Title: "root@web: ~", Offset: 2},
+		{Title: "vim", Offset: int64(len(first)) + 3},
+		{Title: "top", Offset: n + 5},
+		{Title: "vim", Offset: n + 21},
+	}
+	history := terminal.TitleHistory()
+	if fmt.Sprint(history) != fmt.Sprint(expected) {
+		t.Errorf("expected %+v got %+v", expected, history)
+	}
+
+	terminal.Reset()
+	if terminal.Title() != "" || len(terminal.TitleHistory()) != 0 {
+		t.Errorf("expected empty title after reset")
+	}
+
+	// 只恢复压入时保存的部分
+	terminal.Advance([]byte("\x1b]0;T1\x07\x1b[22;1t\x1b]0;T2\x07\x1b[23;0t"))
+	if terminal.Title() != "T2" || terminal.IconName() != "T1" {
+		t.Errorf("unexpected title %q icon %q", terminal.Title(), terminal.IconName())
+	}
+}
+
+func TestCommands(t *testing.T) {
+	prompt := "\x1b]133;A\x07$ \x1b]133;B\x07"
+	var tests = []struct {
+		in     string
+		blocks []CommandBlock
+	}{
+		{
+			"\x1b]7;file://web/srv\x07" + prompt + "ls\r\n\x1b]133;C\x07a\r\nb\r\n\x1b]133;D;0\x07" +
+				prompt + "false\r\n\x1b]133;C\x07\x1b]133;D;1\x07" + prompt + "vi",
+			[]CommandBlock{
+				{Prompt: "$", Command: "ls", Output: []string{"a", "b"}, ExitCode: 0, Finished: true, Dir: "/srv", Host: "web"},
+				{Prompt: "$", Command: "false", ExitCode: 1, Finished: true, Dir: "/srv", Host: "web"},
+				{Prompt: "$", Command: "vi", ExitCode: -1, Dir: "/srv", Host: "web"},
+			},
+		},
+		// 命令和输出自动换行，输出滚出屏幕
+		{
+			prompt + "echo 0123456789\r\n\x1b]133;C\x070123456789\r\n1\r\n2\r\n3\r\n\x1b]133;D\x07",
+			[]CommandBlock{
+				{Prompt: "$", Command: "echo 0123456789", Output: []string{"0123456789", "1", "2", "3"}, ExitCode: -1, Finished: true},
+			},
+		},
+		// 命令正在执行，清屏的内容进入 scrollback
+		{
+			prompt + "top\r\n\x1b]133;C\x07a\x1b[H\x1b[2Jb",
+			[]CommandBlock{
+				{Prompt: "$", Command: "top", Output: []string{"a", "b"}, ExitCode: -1},
+			},
+		},
+		// 在提示符处按下 Ctrl+C，没有收到 D 时新的提示符结束上一条命令
+		{
+			prompt + "ab^C\r\n\x1b]133;D;130\x07" + prompt + "sleep 1\r\n\x1b]133;C\x07" + prompt,
+			[]CommandBlock{
+				{Prompt: "$", Command: "ab^C", ExitCode: 130, Finished: true},
+				{Prompt: "$", Command: "sleep 1", ExitCode: -1, Finished: true},
+				{Prompt: "$", ExitCode: -1},
+			},
+		},
+		// 带有选项的序列，没有 A 和 B 时从 C 开始
+		{
+			"\x1b]133;A;aid=1\x07$ \x1b]133;B\x07pwd\r\n\x1b]133;C;cmdline=pwd\x07/\r\n\x1b]133;D;0;aid=1\x07x\x1b]133;C\x07y\x1b]133;D;2\x07",
+			[]CommandBlock{
+				{Prompt: "$", Command: "pwd", Output: []string{"/"}, ExitCode: 0, Finished: true},
+				{Output: []string{"y"}, ExitCode: 2, Finished: true},
+			},
+		},
+		// 没有使用 OSC 133 时，iTerm2 的 SetMark 作为提示符的开始
+		{
+			"\x1b]1337;SetMark\x07$ ls\r\na\r\n\x1b]1337;SetMark\x07$ ",
+			[]CommandBlock{
+				{Prompt: "$ ls\na", ExitCode: -1, Finished: true},
+				{Prompt: "$", ExitCode: -1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		terminal := New(10, 3)
+		terminal.Advance([]byte(test.in))
+		blocks := terminal.Commands()
+		if fmt.Sprintf("%#v", blocks) != fmt.Sprintf("%#v", test.blocks) {
+			t.Errorf("%q: expected\n%+v got\n%+v", test.in, test.blocks, blocks)
+		}
+	}
+}
+
+func TestHyperlink(t *testing.T) {
+	var tests = []struct {
+		in    string
+		links []LinkRun
+	}{
+		{
+			"\x1b]8;id=f1;file:///tmp/a.c\x1b\\a.c\x1b]8;;\x1b\\ x \x1b]8;;https://go.dev/\x07go\x1b]8;;\x07",
+			[]LinkRun{
+				{Link: Hyperlink{URI: "file:///tmp/a.c", ID: "f1"}, Start: 0, End: 3, Text: "a.c"},
+				{Link: Hyperlink{URI: "https://go.dev/"}, Start: 6, End: 8, Text: "go"},
+			},
+		},
+		// SGR 不影响超链接，URI 中可以包含分号
+		{"\x1b]8;;http://a/?x;y\x07\x1b[1mx\x1b[0my", []LinkRun{{Link: Hyperlink{URI: "http://a/?x;y"}, Start: 0, End: 2, Text: "xy"}}},
+		{"\x1b]8;;http://a\x07你", []LinkRun{{Link: Hyperlink{URI: "http://a"}, Start: 0, End: 2, Text: "你"}}},
+		{"\x1b]8;;http://a\x07\x1b]8;;http://b\x07x", []LinkRun{{Link: Hyperlink{URI: "http://b"}, Start: 0, End: 1, Text: "x"}}},
+		// 擦除的字符不再带有超链接
+		{"\x1b]8;;http://a\x07abc\x1b[2G\x1b[1K", []LinkRun{{Link: Hyperlink{URI: "http://a"}, Start: 2, End: 3, Text: "c"}}},
+		{"\x1b]8;;http://a\x07ab\x1bcx", nil},
+	}
+
+	for _, test := range tests {
+		terminal := New(20, 3)
+		terminal.Advance([]byte(test.in))
+		links := terminal.Screen()[0].Links()
+		if fmt.Sprint(links) != fmt.Sprint(test.links) {
+			t.Errorf("%q: expected %+v got %+v", test.in, test.links, links)
+		}
+	}
+
+	terminal := New(20, 3)
+	terminal.Advance([]byte("\x1b[31m\x1b]8;;https://go.dev/?a=1&b=2\x07go\x1b]8;;\x07\x1b[0m <x>\x1b]8;;javascript:alert(1)\x07js\x1b]8;;\x07\r\n\x1b[1;44mb"))
+	expected := `<pre style="color:#e5e5e5;background-color:#000000">` +
+		`<a href="https://go.dev/?a=1&amp;b=2"><span style="color:#cd0000">go</span></a> &lt;x&gt;js` + "\n" +
+		`<span style="background-color:#0000ee;font-weight:bold">b</span></pre>`
+	if html := terminal.HTML(); html != expected {
+		t.Errorf("expected %s got %s", expected, html)
+	}
+}
+
 func testEq(a, b []string) bool {
 	if len(a) != len(b) {
 		return false